@@ -8,39 +8,64 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"slack2logs/envflag"
+	"slack2logs/flagutil"
+	"slack2logs/output"
 	"slack2logs/slack"
 	"slack2logs/transporter"
-	"slack2logs/vmlogs"
+	"slack2logs/verify"
 )
 
-func main() {
-	log.Println("Start migrate historical messages from slack to vmlogs")
-	startTime := time.Now()
+const (
+	commandBackfill = "backfill"
+	commandArchive  = "archive"
+	commandReplay   = "replay"
+	commandVerify   = "verify"
+)
 
+func main() {
 	flag.CommandLine.SetOutput(os.Stdout)
-	flag.Parse()
+	flag.Usage = usage
+	command, args := parseCommand(os.Args[1:])
+	envflag.ParseFlagSet(flag.CommandLine, args)
+
+	log.Printf("Start migrate historical messages from slack to vmlogs via %q command", command)
+	startTime := time.Now()
 
 	// Create a context that can be used to cancel goroutine
 	ctx, cancel := context.WithCancel(context.Background())
 
-	log.Println("Init slack client")
-	slackClient := slack.New()
-	go func() {
-		log.Println("Start listen message in the channels")
-		if err := slackClient.RunHistoricalBackfilling(ctx); err != nil && !errors.Is(err, context.Canceled) {
-			log.Fatalf("error run slack client: %s", err)
+	var exporter transporter.Exporter
+	switch command {
+	case commandBackfill:
+		exporter = newBackfillExporter(ctx)
+	case commandArchive:
+		log.Println("Init slack archive exporter")
+		exporter = slack.NewArchiveExporter()
+	case commandReplay:
+		log.Println("Init replay exporter")
+		exporter = newReplayExporter()
+	case commandVerify:
+		log.Println("Init verifier")
+		v, err := verify.New(slack.NewClients())
+		if err != nil {
+			log.Fatalf("error initialize verifier: %s", err)
 		}
-	}()
-	log.Println("Init vmlogs client")
-	logs, err := vmlogs.New()
+		exporter = v
+	default:
+		log.Fatalf("unsupported command %q; supported commands: %s, %s, %s, %s", command, commandBackfill, commandArchive, commandReplay, commandVerify)
+	}
+
+	logs, err := output.New()
 	if err != nil {
-		log.Fatalf("error initialize VictoriaLogs client: %s", err)
+		log.Fatalf("error initialize output: %s", err)
 	}
 
-	trns := transporter.New(slackClient, logs)
+	trns := transporter.New(exporter, logs)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -56,3 +81,44 @@ func main() {
 	log.Println("Process stopped successfully")
 	log.Printf("Elapsed time: %s", time.Since(startTime))
 }
+
+// newBackfillExporter starts collecting historical messages via Slack API
+func newBackfillExporter(ctx context.Context) transporter.Exporter {
+	log.Println("Init slack clients")
+	slackClients := slack.NewClients()
+	exporters := make(transporter.MultiExporter, 0, len(slackClients))
+	for _, slackClient := range slackClients {
+		go func(slackClient *slack.Client) {
+			log.Println("Start listen message in the channels")
+			if err := slackClient.RunHistoricalBackfilling(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Fatalf("error run slack client: %s", err)
+			}
+		}(slackClient)
+		exporters = append(exporters, slackClient)
+	}
+	return exporters
+}
+
+// parseCommand returns command name and the rest of args.
+// The command is optional and defaults to backfill.
+func parseCommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commandBackfill, args
+	}
+	return args[0], args[1:]
+}
+
+func usage() {
+	const s = `
+cli collects historical messages and saves them to the VictoriaLogs.
+
+Usage: cli [command] [flags]
+
+Commands:
+  backfill  collects historical messages and threads via Slack API from channels defined via -slack.channels or -slack.workspacesConfig. This is the default command
+  archive   imports messages from Slack workspace export ZIP archives defined via -slack.archive.path
+  replay    re-ingests messages from JSONL files or VictoriaLogs query output defined via -replay.path
+  verify    compares the number of messages per channel per day in Slack and VictoriaLogs and optionally backfills the missing ones, see -verify.* flags
+`
+	flagutil.Usage(s)
+}
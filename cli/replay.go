@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"slack2logs/flagutil"
+	"slack2logs/jsonlfile"
+	"slack2logs/transporter"
+)
+
+var (
+	replayPaths            = flagutil.NewArrayString("replay.path", "Paths to JSONL files or directories to replay messages from. Supports glob patterns. Use - for reading from stdin")
+	replayRateLimit        = flag.Int("replay.rateLimit", 0, "The maximum number of replayed messages per second. Zero means no limit")
+	replayProgressInterval = flag.Duration("replay.progressInterval", 10*time.Second, "Interval for logging replay progress")
+)
+
+// newReplayExporter returns exporter for messages from -replay.path
+func newReplayExporter() transporter.Exporter {
+	if len(*replayPaths) == 0 {
+		log.Fatalf("at least one path must be defined via -replay.path")
+	}
+	r, err := jsonlfile.NewReader(*replayPaths)
+	if err != nil {
+		log.Fatalf("error initialize replay reader: %s", err)
+	}
+	return &replayExporter{
+		exporter:         r,
+		rateLimit:        *replayRateLimit,
+		progressInterval: *replayProgressInterval,
+	}
+}
+
+// replayExporter limits the rate of messages passed from exporter
+// and periodically logs the progress
+type replayExporter struct {
+	exporter         transporter.Exporter
+	rateLimit        int
+	progressInterval time.Duration
+}
+
+// Export implements transporter.Exporter interface
+func (re *replayExporter) Export(ctx context.Context, cb func(m transporter.Message)) {
+	startTime := time.Now()
+	lastReport := startTime
+	n := 0
+	re.exporter.Export(ctx, func(m transporter.Message) {
+		if re.rateLimit > 0 {
+			// sleep until the moment the message is allowed by the rate limit
+			next := startTime.Add(time.Duration(n) * time.Second / time.Duration(re.rateLimit))
+			if d := time.Until(next); d > 0 {
+				t := time.NewTimer(d)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return
+				case <-t.C:
+				}
+			}
+		}
+		cb(m)
+		n++
+		if time.Since(lastReport) >= re.progressInterval {
+			lastReport = time.Now()
+			log.Printf("replayed %d messages; %.1f messages/s", n, float64(n)/time.Since(startTime).Seconds())
+		}
+	})
+	log.Printf("replayed %d messages in %s", n, time.Since(startTime))
+}
@@ -0,0 +1,329 @@
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/transporter"
+	"slack2logs/vmlogs"
+)
+
+var (
+	indexPath = flag.String("dedup.indexPath", "", "Path to the local index of msg_id values of delivered messages. "+
+		"Messages with msg_id from the index are skipped, so re-runs of backfilling and replays after crashes don't produce duplicates. "+
+		"The index is disabled if empty")
+	maxEntries = flag.Int("dedup.maxEntries", 1e6, "The maximum number of msg_id values in a generation of the dedup index. "+
+		"The index keeps the current and the previous generations, so the oldest msg_id values are forgotten when the current generation is full")
+	checkVMLogs = flag.Bool("dedup.checkVMLogs", false, "Whether to check if the message with the same msg_id is already stored in VictoriaLogs before sending it. "+
+		"It allows running backfilling concurrently with the live mode at the cost of an additional query per message")
+)
+
+var (
+	duplicatesCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_dropped_total{source="dedup",reason="duplicate"}`)
+	dedupErrors     = metrics.GetOrCreateCounter(`vm_slack2logs_errors_total{source="dedup"}`)
+)
+
+// querier executes LogsQL queries
+type querier interface {
+	Query(ctx context.Context, query string, cb func(row map[string]string) error) error
+}
+
+// Importer skips messages, which were already delivered, and sends the rest to the next importer.
+// See -dedup.* flags.
+//
+// Messages are marked as delivered only after all the outputs confirm the delivery,
+// since outputs sending messages in batches accept messages before sending them.
+// Importer implements transporter.DeliveryNotifier, so it reports messages once all the outputs deliver them
+// or once they are skipped as already delivered.
+type Importer struct {
+	next transporter.Importer
+	// logs is nil if the check in VictoriaLogs is disabled
+	logs querier
+	// confirmations is the number of delivery confirmations required for every message:
+	// one when Import of the next importer returns and one per output implementing transporter.DeliveryNotifier
+	confirmations int
+	maxEntries    int
+
+	mu sync.Mutex
+	// seen and prevSeen are the current and the previous generations of delivered msg_id values
+	seen     map[string]struct{}
+	prevSeen map[string]struct{}
+	// pending and prevPending contain the number of missing delivery confirmations per msg_id.
+	// Messages pending for the whole generation are considered lost
+	pending     map[string]int
+	prevPending map[string]int
+	// path is empty if the local index is disabled
+	path  string
+	index *os.File
+	// onDelivered contains funcs registered via OnDelivered
+	onDelivered []func(messages []transporter.Message)
+}
+
+// Wrap returns the importer with deduplication if it is enabled via -dedup.* flags.
+// Otherwise next is returned as is.
+func Wrap(next transporter.Importer) (transporter.Importer, error) {
+	if *indexPath == "" && !*checkVMLogs {
+		return next, nil
+	}
+	var logs querier
+	if *checkVMLogs {
+		c, err := vmlogs.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize VictoriaLogs client: %w", err)
+		}
+		logs = c
+	}
+	return newImporter(next, logs, *indexPath, *maxEntries)
+}
+
+func newImporter(next transporter.Importer, logs querier, path string, maxEntries int) (*Importer, error) {
+	im := &Importer{
+		next:        next,
+		logs:        logs,
+		maxEntries:  maxEntries,
+		seen:        make(map[string]struct{}),
+		pending:     make(map[string]int),
+		prevPending: make(map[string]int),
+		path:        path,
+	}
+	im.confirmations = 1 + transporter.OnDelivered(next, im.confirmDelivered)
+	if path == "" {
+		return im, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create directory for dedup index %q: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open dedup index %q: %w", path, err)
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if id := sc.Text(); id != "" {
+			im.seen[id] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("cannot read dedup index %q: %w", path, err)
+	}
+	im.index = f
+	log.Printf("loaded %d msg_id values from dedup index %q", len(im.seen), path)
+	if im.maxEntries > 0 && len(im.seen) >= im.maxEntries {
+		im.mu.Lock()
+		im.rotateLocked()
+		im.mu.Unlock()
+	}
+	return im, nil
+}
+
+// Import sends message to the next importer unless it was already delivered
+func (im *Importer) Import(ctx context.Context, message transporter.Message) error {
+	message.SetMsgID()
+	if message.MsgID == "" {
+		// the message cannot be identified, so it cannot be deduplicated
+		return im.next.Import(ctx, message)
+	}
+	im.mu.Lock()
+	ok := im.isSeenLocked(message.MsgID)
+	im.mu.Unlock()
+	if ok {
+		duplicatesCount.Inc()
+		im.notify([]transporter.Message{message})
+		return nil
+	}
+	if im.logs != nil {
+		stored, err := im.isStored(ctx, &message)
+		if err != nil {
+			// prefer a possible duplicate to a lost message
+			log.Printf("error check message %s in VictoriaLogs: %s", message.MsgID, err)
+			dedupErrors.Inc()
+		}
+		if stored {
+			duplicatesCount.Inc()
+			im.mu.Lock()
+			im.markSeenLocked(message.MsgID)
+			im.mu.Unlock()
+			im.notify([]transporter.Message{message})
+			return nil
+		}
+	}
+	im.mu.Lock()
+	im.pending[message.MsgID] += im.confirmations
+	im.mu.Unlock()
+	if err := im.next.Import(ctx, message); err != nil {
+		im.mu.Lock()
+		delete(im.pending, message.MsgID)
+		im.mu.Unlock()
+		return err
+	}
+	if im.confirm(message.MsgID) {
+		im.notify([]transporter.Message{message})
+	}
+	return nil
+}
+
+// OnDelivered registers f, which is called with messages after they are delivered by all the outputs.
+// It implements transporter.DeliveryNotifier.
+func (im *Importer) OnDelivered(f func(messages []transporter.Message)) {
+	im.mu.Lock()
+	im.onDelivered = append(im.onDelivered, f)
+	im.mu.Unlock()
+}
+
+func (im *Importer) notify(messages []transporter.Message) {
+	im.mu.Lock()
+	fs := im.onDelivered
+	im.mu.Unlock()
+	for _, f := range fs {
+		f(messages)
+	}
+}
+
+// confirmDelivered is called by outputs implementing transporter.DeliveryNotifier after messages are delivered
+func (im *Importer) confirmDelivered(messages []transporter.Message) {
+	var delivered []transporter.Message
+	for i := range messages {
+		if id := messages[i].MsgID; id != "" && im.confirm(id) {
+			delivered = append(delivered, messages[i])
+		}
+	}
+	if len(delivered) > 0 {
+		im.notify(delivered)
+	}
+}
+
+// confirm registers delivery confirmation for the message with the given id.
+// The message is marked as delivered when all the required confirmations are received.
+// It returns true if the message is marked as delivered.
+func (im *Importer) confirm(id string) bool {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	pending := im.pending
+	n, ok := pending[id]
+	if !ok {
+		pending = im.prevPending
+		if n, ok = pending[id]; !ok {
+			// the message was rejected by another output or it was pending for too long
+			return false
+		}
+	}
+	if n > 1 {
+		pending[id] = n - 1
+		return false
+	}
+	delete(pending, id)
+	im.markSeenLocked(id)
+	return true
+}
+
+func (im *Importer) isSeenLocked(id string) bool {
+	if _, ok := im.seen[id]; ok {
+		return true
+	}
+	_, ok := im.prevSeen[id]
+	return ok
+}
+
+// isStored checks whether the message with the same msg_id is stored in VictoriaLogs
+func (im *Importer) isStored(ctx context.Context, m *transporter.Message) (bool, error) {
+	q := fmt.Sprintf(`msg_id:=%s | limit 1`, m.MsgID)
+	if t, err := m.Time(); err == nil {
+		// narrow down the search to the message time, since it is used as _time
+		start := t.UTC().Truncate(time.Second)
+		q = fmt.Sprintf(`_time:[%s, %s) %s`, start.Format(time.RFC3339), start.Add(time.Second).Format(time.RFC3339), q)
+	}
+	stored := false
+	err := im.logs.Query(ctx, q, func(_ map[string]string) error {
+		stored = true
+		return nil
+	})
+	return stored, err
+}
+
+func (im *Importer) markSeenLocked(id string) {
+	im.seen[id] = struct{}{}
+	if im.index != nil {
+		if _, err := im.index.WriteString(id + "\n"); err != nil {
+			log.Printf("error write msg_id to dedup index: %s", err)
+			dedupErrors.Inc()
+		}
+	}
+	if im.maxEntries > 0 && len(im.seen) >= im.maxEntries {
+		im.rotateLocked()
+	}
+}
+
+// rotateLocked starts a new generation of msg_id values and forgets the previous one.
+// The index is rewritten with the remaining generation, so its size is limited.
+func (im *Importer) rotateLocked() {
+	im.prevSeen = im.seen
+	im.seen = make(map[string]struct{})
+	im.prevPending = im.pending
+	im.pending = make(map[string]int)
+	if im.index == nil {
+		return
+	}
+	if err := im.rewriteIndexLocked(); err != nil {
+		log.Printf("error rewrite dedup index %q: %s", im.path, err)
+		dedupErrors.Inc()
+	}
+}
+
+// rewriteIndexLocked replaces the index with msg_id values from the previous generation
+func (im *Importer) rewriteIndexLocked() error {
+	tmpPath := im.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for id := range im.prevSeen {
+		_, _ = bw.WriteString(id + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// write to temporary file first, so the index isn't corrupted on crash
+	if err := os.Rename(tmpPath, im.path); err != nil {
+		return err
+	}
+	index, err := os.OpenFile(im.path, os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	_ = im.index.Close()
+	im.index = index
+	return nil
+}
+
+// Close closes the next importer if it implements io.Closer and the index afterwards,
+// so messages delivered on close are added to the index
+func (im *Importer) Close() error {
+	var errs []error
+	if c, ok := im.next.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.index != nil {
+		errs = append(errs, im.index.Close())
+		im.index = nil
+	}
+	return errors.Join(errs...)
+}
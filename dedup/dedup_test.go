@@ -0,0 +1,180 @@
+package dedup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"slack2logs/transporter"
+)
+
+type fakeImporter struct {
+	messages []transporter.Message
+}
+
+func (fi *fakeImporter) Import(_ context.Context, m transporter.Message) error {
+	fi.messages = append(fi.messages, m)
+	return nil
+}
+
+// fakeBatchImporter accepts messages and confirms their delivery on flush
+type fakeBatchImporter struct {
+	fakeImporter
+	pending     []transporter.Message
+	onDelivered []func(messages []transporter.Message)
+}
+
+func (fi *fakeBatchImporter) Import(_ context.Context, m transporter.Message) error {
+	fi.pending = append(fi.pending, m)
+	return nil
+}
+
+func (fi *fakeBatchImporter) OnDelivered(f func(messages []transporter.Message)) {
+	fi.onDelivered = append(fi.onDelivered, f)
+}
+
+func (fi *fakeBatchImporter) flush() {
+	for _, f := range fi.onDelivered {
+		f(fi.pending)
+	}
+	fi.messages = append(fi.messages, fi.pending...)
+	fi.pending = nil
+}
+
+// fakeQuerier returns a row for queries containing stored msg_id values
+type fakeQuerier map[string]struct{}
+
+func (fq fakeQuerier) Query(_ context.Context, query string, cb func(row map[string]string) error) error {
+	for id := range fq {
+		if strings.Contains(query, "msg_id:="+id) {
+			return cb(map[string]string{"msg_id": id})
+		}
+	}
+	return nil
+}
+
+// Test for Importer.Import method
+func TestImporter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index")
+	m1 := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100", TimeStamp: "2024-01-16T10:00:00.0001Z"}
+	m2 := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399260.000200", TimeStamp: "2024-01-16T10:01:00.0002Z"}
+	m3 := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399320.000300", TimeStamp: "2024-01-16T10:02:00.0003Z"}
+
+	next := &fakeImporter{}
+	im, err := newImporter(next, nil, path, 100)
+	if err != nil {
+		t.Fatalf("cannot create importer: %s", err)
+	}
+	for _, m := range []transporter.Message{m1, m2, m1} {
+		if err := im.Import(ctx, m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(next.messages) != 2 {
+		t.Fatalf("unexpected number of delivered messages; got %d; want 2", len(next.messages))
+	}
+	if err := im.Close(); err != nil {
+		t.Fatalf("cannot close importer: %s", err)
+	}
+
+	// the index is loaded after restart and m3 is already stored in VictoriaLogs
+	next = &fakeImporter{}
+	im, err = newImporter(next, fakeQuerier{transporter.NewMsgID(&m3): {}}, path, 100)
+	if err != nil {
+		t.Fatalf("cannot load importer: %s", err)
+	}
+	defer func() { _ = im.Close() }()
+	m4 := m3
+	m4.EditedTS = "1705399400.000000"
+	for _, m := range []transporter.Message{m1, m2, m3, m4} {
+		if err := im.Import(ctx, m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(next.messages) != 1 || next.messages[0].EditedTS != m4.EditedTS || next.messages[0].MsgID == "" {
+		t.Fatalf("unexpected delivered messages: %+v", next.messages)
+	}
+}
+
+// Test for Importer waiting for delivery confirmations from outputs sending messages in batches
+func TestImporterDeliveryConfirmation(t *testing.T) {
+	ctx := context.Background()
+	m1 := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100"}
+	m2 := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399260.000200"}
+
+	direct := &fakeImporter{}
+	batch := &fakeBatchImporter{}
+	im, err := newImporter(transporter.MultiImporter{direct, batch}, nil, "", 100)
+	if err != nil {
+		t.Fatalf("cannot create importer: %s", err)
+	}
+	var delivered []string
+	im.OnDelivered(func(messages []transporter.Message) {
+		for _, m := range messages {
+			delivered = append(delivered, m.MessageTS)
+		}
+	})
+	// m1 isn't flushed yet, so it is sent again
+	for _, m := range []transporter.Message{m1, m1} {
+		if err := im.Import(ctx, m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(batch.pending) != 2 {
+		t.Fatalf("unexpected number of pending messages; got %d; want 2", len(batch.pending))
+	}
+	if len(delivered) != 0 {
+		t.Fatalf("unexpected delivered messages before flush: %q", delivered)
+	}
+	batch.flush()
+	if len(delivered) != 1 || delivered[0] != m1.MessageTS {
+		t.Fatalf("unexpected delivered messages after flush: %q", delivered)
+	}
+	for _, m := range []transporter.Message{m1, m2} {
+		if err := im.Import(ctx, m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(batch.pending) != 1 || batch.pending[0].MessageTS != m2.MessageTS {
+		t.Fatalf("unexpected pending messages: %+v", batch.pending)
+	}
+	// skipped duplicates are reported as delivered, while m2 waits for the flush
+	if len(delivered) != 2 || delivered[1] != m1.MessageTS {
+		t.Fatalf("unexpected delivered messages: %q", delivered)
+	}
+}
+
+// Test for Importer forgetting the oldest msg_id values
+func TestImporterRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index")
+	newMessage := func(ts string) transporter.Message {
+		return transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: ts}
+	}
+	next := &fakeImporter{}
+	im, err := newImporter(next, nil, path, 2)
+	if err != nil {
+		t.Fatalf("cannot create importer: %s", err)
+	}
+	defer func() { _ = im.Close() }()
+	// the first generation is full after 2 messages, the second one after 4 messages,
+	// so the first generation is forgotten
+	for _, ts := range []string{"1.000001", "1.000002", "1.000003", "1.000004", "1.000003", "1.000001"} {
+		if err := im.Import(ctx, newMessage(ts)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(next.messages) != 5 || next.messages[4].MessageTS != "1.000001" {
+		t.Fatalf("unexpected delivered messages: %+v", next.messages)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read index: %s", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Fatalf("unexpected number of msg_id values in the index; got %d; want 3", n)
+	}
+}
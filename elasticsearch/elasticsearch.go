@@ -0,0 +1,270 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/auth"
+	"slack2logs/transporter"
+)
+
+const bulkPath = "_bulk"
+
+var (
+	esAddr     = flag.String("elasticsearch.addr", "http://localhost:9200", "Elasticsearch or OpenSearch address to send messages to if -output contains elasticsearch")
+	esUser     = flag.String("elasticsearch.auth.user", "", "Username for Elasticsearch HTTP server's Basic Auth.")
+	esPassword = flag.String("elasticsearch.auth.password", "", "Password for Elasticsearch HTTP server's Basic Auth.")
+	esIndex    = flag.String("elasticsearch.index", "slack-%{channel_name}-2006.01", "Index name template. %{field} placeholders are substituted by the message fields, "+
+		"the rest of the template is formatted with the message time according to Go time layout, see https://pkg.go.dev/time#pkg-constants")
+	esBatchSize     = flag.Int("elasticsearch.batchSize", 1000, "The maximum number of messages in a single bulk request to Elasticsearch")
+	esFlushInterval = flag.Duration("elasticsearch.flushInterval", 5*time.Second, "The maximum interval between bulk requests to Elasticsearch if there are pending messages")
+	esMaxRetries    = flag.Int("elasticsearch.maxRetries", 3, "The maximum number of retries for bulk items rejected by Elasticsearch with retryable status codes such as 429")
+	esRetryInterval = flag.Duration("elasticsearch.retryInterval", time.Second, "Interval between retries of rejected bulk items")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="elasticsearch"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="elasticsearch"}`)
+)
+
+// Client is an HTTP client for indexing
+// messages via Elasticsearch bulk API.
+// See https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+type Client struct {
+	authCfg       *auth.Config
+	httpClient    *http.Client
+	url           *url.URL
+	index         *indexTemplate
+	maxRetries    int
+	retryInterval time.Duration
+	batcher       *transporter.Batcher
+}
+
+// bulkResponse represents response of the bulk API
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Index  string         `json:"_index"`
+	ID     string         `json:"_id"`
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error,omitempty"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// document represents a single document in the bulk request
+type document struct {
+	index string
+	id    string
+	body  []byte
+}
+
+// New returns Client configured via -elasticsearch.* flags
+func New() (*Client, error) {
+	authCfg, err := auth.Generate(auth.WithBasicAuth(*esUser, *esPassword))
+	if err != nil {
+		return nil, fmt.Errorf("error create elasticsearch authentication configuration: %w", err)
+	}
+	u, err := url.Parse(fmt.Sprintf("%s/%s", strings.TrimSuffix(*esAddr, "/"), bulkPath))
+	if err != nil {
+		return nil, fmt.Errorf("incorrect bulk address defined %s: %w", *esAddr, err)
+	}
+	index, err := parseIndexTemplate(*esIndex)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect -elasticsearch.index=%q: %w", *esIndex, err)
+	}
+	c := &Client{
+		authCfg: authCfg,
+		httpClient: &http.Client{
+			Transport: &http.Transport{},
+			Timeout:   30 * time.Second,
+		},
+		url:           u,
+		index:         index,
+		maxRetries:    *esMaxRetries,
+		retryInterval: *esRetryInterval,
+	}
+	c.batcher = transporter.NewBatcher(*esBatchSize, *esFlushInterval, c.bulk)
+	return c, nil
+}
+
+// Import adds message to the batch, which is sent
+// to Elasticsearch when it is full or on -elasticsearch.flushInterval
+func (c *Client) Import(ctx context.Context, message transporter.Message) error {
+	return c.batcher.Add(ctx, message)
+}
+
+// OnDelivered registers f, which is called with messages after they are sent.
+// It implements transporter.DeliveryNotifier.
+func (c *Client) OnDelivered(f func(messages []transporter.Message)) {
+	c.batcher.OnDelivered(f)
+}
+
+// Close sends pending messages to Elasticsearch
+func (c *Client) Close() error {
+	return c.batcher.Close()
+}
+
+func (c *Client) bulk(ctx context.Context, messages []transporter.Message) error {
+	messagesDeliveryCount.Add(len(messages))
+	docs := make([]document, 0, len(messages))
+	var errs []error
+	for i := range messages {
+		doc, err := c.newDocument(&messages[i])
+		if err != nil {
+			handleMessageErrors.Inc()
+			errs = append(errs, err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	for attempt := 0; len(docs) > 0; attempt++ {
+		if attempt > 0 {
+			log.Printf("retrying %d rejected documents in %s", len(docs), c.retryInterval)
+			t := time.NewTimer(c.retryInterval)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				handleMessageErrors.Add(len(docs))
+				return errors.Join(append(errs, ctx.Err())...)
+			case <-t.C:
+			}
+		}
+		resp, err := c.send(ctx, docs)
+		if err != nil {
+			handleMessageErrors.Add(len(docs))
+			return errors.Join(append(errs, err)...)
+		}
+		if !resp.Errors {
+			break
+		}
+		if len(resp.Items) != len(docs) {
+			handleMessageErrors.Add(len(docs))
+			return errors.Join(append(errs, fmt.Errorf("unexpected number of items in bulk response; got %d; want %d", len(resp.Items), len(docs)))...)
+		}
+		var retry []document
+		for i, item := range resp.Items {
+			result := item["index"]
+			if result.Error == nil {
+				continue
+			}
+			err := fmt.Errorf("cannot index document %q into %q: status %d: %s: %s", result.ID, result.Index, result.Status, result.Error.Type, result.Error.Reason)
+			if !isRetryableStatus(result.Status) {
+				handleMessageErrors.Inc()
+				errs = append(errs, err)
+				continue
+			}
+			if attempt >= c.maxRetries {
+				// documents have stable ids, so the whole batch can be sent again later
+				handleMessageErrors.Add(len(docs))
+				return errors.Join(append(errs, err)...)
+			}
+			retry = append(retry, docs[i])
+		}
+		docs = retry
+	}
+	// the remaining errors are caused by invalid or rejected documents, so retrying cannot help
+	return transporter.Permanent(errors.Join(errs...))
+}
+
+func (c *Client) send(ctx context.Context, docs []document) (*bulkResponse, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		action := map[string]map[string]string{
+			"index": {"_index": doc.index, "_id": doc.id},
+		}
+		if err := json.NewEncoder(&buf).Encode(action); err != nil {
+			return nil, fmt.Errorf("error marshal bulk action: %w", err)
+		}
+		buf.Write(doc.body)
+		buf.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.String(), &buf)
+	if err != nil {
+		return nil, fmt.Errorf("error create bulk request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.authCfg != nil {
+		c.authCfg.SetHeaders(req, true)
+	}
+	return c.do(req)
+}
+
+func (c *Client) do(req *http.Request) (*bulkResponse, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error when performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body for status code %d: %s", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected response code %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			// the request is rejected, so retrying it cannot help
+			return nil, transporter.Permanent(err)
+		}
+		return nil, err
+	}
+	var br bulkResponse
+	if err := json.Unmarshal(body, &br); err != nil {
+		return nil, fmt.Errorf("cannot parse bulk response: %w", err)
+	}
+	return &br, nil
+}
+
+func (c *Client) newDocument(m *transporter.Message) (document, error) {
+	t, err := m.Time()
+	if err != nil {
+		return document{}, fmt.Errorf("cannot parse message timestamp %q: %w", m.TimeStamp, err)
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return document{}, fmt.Errorf("error marshal message: %w", err)
+	}
+	return document{
+		index: c.index.format(m, t),
+		id:    documentID(m),
+		body:  body,
+	}, nil
+}
+
+// documentID returns stable document id for the message,
+// so retries and repeated backfills overwrite the same document.
+// Messages without Slack ts, for example replayed from old dumps, are identified by their time.
+func documentID(m *transporter.Message) string {
+	key := m.MessageTS
+	if key == "" {
+		key = m.TimeStamp
+	}
+	h := sha256.Sum256([]byte(m.ChannelID + "/" + key))
+	return hex.EncodeToString(h[:16])
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,148 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+// Test for indexTemplate.format method
+func TestIndexTemplateFormat(t *testing.T) {
+	f := func(template string, m transporter.Message, want string) {
+		t.Helper()
+		it, err := parseIndexTemplate(template)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ts, err := m.Time()
+		if err != nil {
+			t.Fatalf("cannot parse message time: %s", err)
+		}
+		if got := it.format(&m, ts); got != want {
+			t.Fatalf("unexpected index name; got %q; want %q", got, want)
+		}
+	}
+	m := transporter.Message{ChannelID: "C1", ChannelName: "Dev-2 Team", TimeStamp: "2024-01-16T10:00:00Z"}
+	f("slack-%{channel_name}-2006.01", m, "slack-dev-2_team-2024.01")
+	f("slack-%{channel_id}", m, "slack-c1")
+	f("slack-%{unknown}-2006.01.02", m, "slack--2024.01.16")
+	f("slack", m, "slack")
+}
+
+// Test for parseIndexTemplate function with invalid templates
+func TestParseIndexTemplateFailure(t *testing.T) {
+	for _, s := range []string{"", "slack-%{channel_name", "slack-%{}"} {
+		if _, err := parseIndexTemplate(s); err == nil {
+			t.Errorf("expecting non-nil error for template %q", s)
+		}
+	}
+}
+
+// bulkServer mimics Elasticsearch bulk API.
+// It rejects the document with text "bad" with mapping error
+// and the document with text "busy" with 429 on the first attempt.
+type bulkServer struct {
+	mu        sync.Mutex
+	docs      map[string]transporter.Message
+	busySeen  bool
+	requests  int
+	lastIndex string
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	var resp bulkResponse
+	sc := bufio.NewScanner(r.Body)
+	for sc.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(sc.Bytes(), &action); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !sc.Scan() {
+			http.Error(w, "missing document", http.StatusBadRequest)
+			return
+		}
+		var m transporter.Message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		meta := action["index"]
+		s.lastIndex = meta["_index"]
+		result := bulkItemResult{Index: meta["_index"], ID: meta["_id"], Status: http.StatusCreated}
+		switch {
+		case m.Text == "bad":
+			result.Status = http.StatusBadRequest
+			result.Error = &bulkItemError{Type: "mapper_parsing_exception", Reason: "failed to parse"}
+		case m.Text == "busy" && !s.busySeen:
+			s.busySeen = true
+			result.Status = http.StatusTooManyRequests
+			result.Error = &bulkItemError{Type: "es_rejected_execution_exception", Reason: "rejected execution"}
+		default:
+			s.docs[meta["_id"]] = m
+		}
+		if result.Error != nil {
+			resp.Errors = true
+		}
+		resp.Items = append(resp.Items, map[string]bulkItemResult{"index": result})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Test for Client bulk requests with per-item errors
+func TestClientBulk(t *testing.T) {
+	bs := &bulkServer{docs: make(map[string]transporter.Message)}
+	srv := httptest.NewServer(bs)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/" + bulkPath)
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+	it, err := parseIndexTemplate("slack-%{channel_name}-2006.01")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &Client{
+		httpClient:    srv.Client(),
+		url:           u,
+		index:         it,
+		maxRetries:    3,
+		retryInterval: time.Millisecond,
+	}
+
+	messages := []transporter.Message{
+		{Text: "ok", ChannelID: "C1", ChannelName: "general", TimeStamp: "2024-01-16T10:00:00Z"},
+		{Text: "bad", ChannelID: "C1", ChannelName: "general", TimeStamp: "2024-01-16T10:00:01Z"},
+		{Text: "busy", ChannelID: "C1", ChannelName: "general", TimeStamp: "2024-01-16T10:00:02Z"},
+	}
+	err = c.bulk(context.Background(), messages)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for the rejected document")
+	}
+	if len(bs.docs) != 2 || bs.requests != 2 {
+		t.Fatalf("unexpected state; got %d documents after %d requests; want 2 documents after 2 requests", len(bs.docs), bs.requests)
+	}
+	if bs.lastIndex != "slack-general-2024.01" {
+		t.Fatalf("unexpected index %q", bs.lastIndex)
+	}
+
+	// repeated import of the same messages must not create duplicates
+	if err := c.bulk(context.Background(), messages[:1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(bs.docs) != 2 {
+		t.Fatalf("unexpected number of documents after re-import; got %d; want 2", len(bs.docs))
+	}
+}
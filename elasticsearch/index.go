@@ -0,0 +1,85 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+// indexTemplate generates index names for messages
+type indexTemplate struct {
+	parts []indexTemplatePart
+}
+
+// indexTemplatePart is either a time layout or a message field placeholder
+type indexTemplatePart struct {
+	layout string
+	field  string
+}
+
+// parseIndexTemplate parses template like slack-%{channel_name}-2006.01
+func parseIndexTemplate(s string) (*indexTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("index template cannot be empty")
+	}
+	var it indexTemplate
+	for len(s) > 0 {
+		n := strings.Index(s, "%{")
+		if n < 0 {
+			it.parts = append(it.parts, indexTemplatePart{layout: s})
+			break
+		}
+		if n > 0 {
+			it.parts = append(it.parts, indexTemplatePart{layout: s[:n]})
+		}
+		s = s[n+2:]
+		n = strings.IndexByte(s, '}')
+		if n < 0 {
+			return nil, fmt.Errorf("missing closing } for placeholder")
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("empty placeholder")
+		}
+		it.parts = append(it.parts, indexTemplatePart{field: s[:n]})
+		s = s[n+1:]
+	}
+	return &it, nil
+}
+
+// format returns index name for the message m with time t.
+// Field values are inserted as is, so they aren't interpreted as time layout.
+func (it *indexTemplate) format(m *transporter.Message, t time.Time) string {
+	var fields map[string]string
+	var b strings.Builder
+	for _, p := range it.parts {
+		if p.field == "" {
+			b.WriteString(t.UTC().Format(p.layout))
+			continue
+		}
+		if fields == nil {
+			fs := m.Fields()
+			fields = make(map[string]string, len(fs))
+			for _, f := range fs {
+				fields[f.Name] = f.Value
+			}
+		}
+		b.WriteString(fields[p.field])
+	}
+	return sanitizeIndexName(b.String())
+}
+
+// sanitizeIndexName makes s a valid index name:
+// it must be lowercase and cannot contain \, /, *, ?, ", <, >, |, space, comma and #
+// See https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-create-index.html#indices-create-api-path-params
+func sanitizeIndexName(s string) string {
+	s = strings.ToLower(s)
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', '/', '*', '?', '"', '<', '>', '|', ' ', ',', '#', ':':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -17,13 +17,27 @@ var (
 	maxGracefulShutdownDuration = flag.Duration("http.maxGracefulShutdownDuration", 3*time.Second, `The maximum duration for a graceful shutdown of the HTTP server. A highly loaded server may require increased value for a graceful shutdown`)
 )
 
-var server *http.Server
+var (
+	server *http.Server
+
+	// extraHandlers contains handlers registered via Handle func
+	extraHandlers = make(map[string]http.Handler)
+)
+
+// Handle registers additional handler for the given pattern.
+// It must be called before Serve.
+func Handle(pattern string, handler http.Handler) {
+	extraHandlers[pattern] = handler
+}
 
 func Serve() {
 	mux := http.NewServeMux()
 	mux.Handle("/", handleRootPath())
 	mux.Handle("/metrics", handleMetricsPath())
 	mux.Handle("/health", handleHealth())
+	for pattern, handler := range extraHandlers {
+		mux.Handle(pattern, handler)
+	}
 
 	server = &http.Server{
 		Addr:    *listenAddr,
@@ -0,0 +1,230 @@
+package jsonlfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+func newTestWriter(t *testing.T, compression string, maxFileSize int64) *Writer {
+	t.Helper()
+	return &Writer{
+		dir:               t.TempDir(),
+		compression:       compression,
+		partitionInterval: 24 * time.Hour,
+		maxFileSize:       maxFileSize,
+		maxOpenFiles:      2,
+		idleTimeout:       time.Minute,
+		files:             make(map[fileKey]*file),
+	}
+}
+
+// Test for writing messages with Writer and reading them back with Reader
+func TestWriterReader(t *testing.T) {
+	for _, compression := range []string{compressionNone, compressionGzip, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			w := newTestWriter(t, compression, 0)
+			messages := []transporter.Message{
+				{ChannelID: "C1", Text: "day 1", TimeStamp: "2024-01-16T10:00:00Z"},
+				{ChannelID: "C2", Text: "other channel", TimeStamp: "2024-01-16T11:00:00Z"},
+				{ChannelID: "C1", Text: "day 1 again", TimeStamp: "2024-01-16T12:00:00Z"},
+				{ChannelID: "C1", Text: "day 2", TimeStamp: "2024-01-17T10:00:00Z"},
+				{ChannelID: "C3", Text: "evicts the least recently used file", TimeStamp: "2024-01-17T10:00:00Z"},
+			}
+			for _, m := range messages {
+				if err := w.Import(context.Background(), m); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error on close: %s", err)
+			}
+
+			files := listFiles(t, w.dir)
+			ext := w.fileExtension()
+			want := []string{
+				"C1/2024-01-16_0" + ext,
+				"C1/2024-01-17_0" + ext,
+				"C2/2024-01-16_0" + ext,
+				"C3/2024-01-17_0" + ext,
+			}
+			if strings.Join(files, ",") != strings.Join(want, ",") {
+				t.Fatalf("unexpected files;\ngot\n%s\nwant\n%s", files, want)
+			}
+
+			r, err := NewReader([]string{w.dir})
+			if err != nil {
+				t.Fatalf("cannot create reader: %s", err)
+			}
+			var got []string
+			r.Export(context.Background(), func(m transporter.Message) {
+				got = append(got, m.Text)
+			})
+			if len(got) != len(messages) {
+				t.Fatalf("unexpected number of messages read; got %d; want %d", len(got), len(messages))
+			}
+			if got[0] != "day 1" || got[1] != "day 1 again" {
+				t.Fatalf("unexpected order of messages: %q", got)
+			}
+		})
+	}
+}
+
+// Test for Writer rotation by file size
+func TestWriterMaxFileSize(t *testing.T) {
+	w := newTestWriter(t, compressionNone, 1)
+	for i := 0; i < 3; i++ {
+		m := transporter.Message{ChannelID: "C1", Text: "message", TimeStamp: "2024-01-16T10:00:00Z"}
+		if err := w.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+	files := listFiles(t, w.dir)
+	want := "C1/2024-01-16_0.jsonl,C1/2024-01-16_1.jsonl,C1/2024-01-16_2.jsonl"
+	if strings.Join(files, ",") != want {
+		t.Fatalf("unexpected files; got %s; want %s", files, want)
+	}
+}
+
+// Test for Writer finalizing files on idle timeout instead of the arrival order
+func TestWriterFinalizeIdle(t *testing.T) {
+	w := newTestWriter(t, compressionNone, 0)
+	w.maxOpenFiles = 10
+	// messages arrive newest first, for example during backfilling
+	for _, ts := range []string{"2024-01-17T10:00:00Z", "2024-01-16T10:00:00Z", "2024-01-17T09:00:00Z", "2024-01-16T09:00:00Z"} {
+		m := transporter.Message{ChannelID: "C1", Text: "message", TimeStamp: ts}
+		if err := w.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := w.finalizeIdle(time.Now()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if files := listFiles(t, w.dir); strings.Join(files, ",") != "C1/2024-01-16_0.jsonl.tmp,C1/2024-01-17_0.jsonl.tmp" {
+		t.Fatalf("unexpected files before idle timeout: %s", files)
+	}
+	if err := w.finalizeIdle(time.Now().Add(w.idleTimeout)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if files := listFiles(t, w.dir); strings.Join(files, ",") != "C1/2024-01-16_0.jsonl,C1/2024-01-17_0.jsonl" {
+		t.Fatalf("unexpected files after idle timeout: %s", files)
+	}
+	if len(w.files) != 0 {
+		t.Fatalf("unexpected number of open files; got %d; want 0", len(w.files))
+	}
+}
+
+// Test for finalizing files left unfinished after a crash
+func TestRecoverTmpFiles(t *testing.T) {
+	w := newTestWriter(t, compressionNone, 0)
+	for _, text := range []string{"first", "second"} {
+		m := transporter.Message{ChannelID: "C1", Text: text, TimeStamp: "2024-01-16T10:00:00Z"}
+		if err := w.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	// simulate a crash in the middle of writing a message
+	f := w.files[fileKey{channelID: "C1", period: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC).Unix()}]
+	if _, err := f.f.WriteString(`{"channel_id":"C1","text":"trunc`); err != nil {
+		t.Fatalf("cannot write truncated message: %s", err)
+	}
+	_ = f.f.Close()
+	if err := os.WriteFile(filepath.Join(w.dir, "C1", "2024-01-17_0.jsonl.tmp"), nil, 0o644); err != nil {
+		t.Fatalf("cannot create empty file: %s", err)
+	}
+
+	if err := recoverTmpFiles(w.dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if files := listFiles(t, w.dir); strings.Join(files, ",") != "C1/2024-01-16_0.jsonl" {
+		t.Fatalf("unexpected files after recovery: %s", files)
+	}
+	r, err := NewReader([]string{w.dir})
+	if err != nil {
+		t.Fatalf("cannot create reader: %s", err)
+	}
+	var got []string
+	r.Export(context.Background(), func(m transporter.Message) {
+		got = append(got, m.Text)
+	})
+	if strings.Join(got, ",") != "first,second" {
+		t.Fatalf("unexpected messages read from recovered file: %q", got)
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot list files: %s", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Test for parseMessage function
+func TestParseMessage(t *testing.T) {
+	f := func(line string, want transporter.Message) {
+		t.Helper()
+		got, err := parseMessage([]byte(line))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != want {
+			t.Fatalf("unexpected message;\ngot\n%+v\nwant\n%+v", got, want)
+		}
+	}
+
+	// message written by Writer
+	f(`{"text":"hello","ts":"2024-01-16T10:00:00Z","channel_id":"C1","channel_name":"general","thread_ts":"1705467634.457089"}`, transporter.Message{
+		Text:            "hello",
+		TimeStamp:       "2024-01-16T10:00:00Z",
+		ChannelID:       "C1",
+		ChannelName:     "general",
+		ThreadTimeStamp: "1705467634.457089",
+	})
+
+	// VictoriaLogs query response
+	f(`{"_msg":"hello","_stream":"{channel_id=\"C1\",channel_name=\"general\"}","_stream_id":"0000","_time":"2024-01-16T10:00:00Z","channel_id":"C1","channel_name":"general","thread_ts":"1705467634.457089","unknown":"field"}`, transporter.Message{
+		Text:            "hello",
+		TimeStamp:       "2024-01-16T10:00:00Z",
+		ChannelID:       "C1",
+		ChannelName:     "general",
+		ThreadTimeStamp: "1705467634.457089",
+	})
+}
+
+// Test for Reader reading from stdin-like stream with invalid lines
+func TestReadMessagesInvalidLine(t *testing.T) {
+	r := strings.NewReader("{\"text\":\"first\"}\nnot a json\n{\"text\":\"third\"}\n")
+	var got []string
+	n, err := readMessages(context.Background(), r, func(m transporter.Message) {
+		got = append(got, m.Text)
+	})
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if n != 1 || len(got) != 1 || got[0] != "first" {
+		t.Fatalf("unexpected messages read before the error: %q", got)
+	}
+}
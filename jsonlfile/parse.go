@@ -0,0 +1,115 @@
+package jsonlfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"slack2logs/transporter"
+)
+
+// VictoriaLogs special fields
+// See https://docs.victoriametrics.com/victorialogs/keyconcepts/
+const (
+	vlogsMsgField      = "_msg"
+	vlogsTimeField     = "_time"
+	vlogsStreamField   = "_stream"
+	vlogsStreamIDField = "_stream_id"
+)
+
+// messageFields maps json field names of transporter.Message to struct field indexes
+var messageFields = func() map[string]int {
+	t := reflect.TypeOf(transporter.Message{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// parseMessage parses a single line with message.
+//
+// The line can be either a transporter.Message in JSON
+// or a log entry from VictoriaLogs /select/logsql/query response.
+// See https://docs.victoriametrics.com/victorialogs/querying/#http-api
+func parseMessage(line []byte) (transporter.Message, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return transporter.Message{}, err
+	}
+	if _, ok := fields[vlogsMsgField]; !ok {
+		var m transporter.Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			return transporter.Message{}, err
+		}
+		return m, nil
+	}
+	return parseVLogsEntry(fields)
+}
+
+// parseVLogsEntry converts VictoriaLogs log entry to transporter.Message.
+// VictoriaLogs returns all the field values as strings,
+// so they are converted to the types of the corresponding Message fields.
+func parseVLogsEntry(fields map[string]json.RawMessage) (transporter.Message, error) {
+	var m transporter.Message
+	v := reflect.ValueOf(&m).Elem()
+	for name, raw := range fields {
+		switch name {
+		case vlogsMsgField:
+			name = "text"
+		case vlogsTimeField:
+			name = "ts"
+		case vlogsStreamField, vlogsStreamIDField:
+			continue
+		}
+		idx, ok := messageFields[name]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			// the value isn't a string, so it can be decoded directly
+			if err := json.Unmarshal(raw, v.Field(idx).Addr().Interface()); err != nil {
+				return m, fmt.Errorf("cannot parse field %q: %w", name, err)
+			}
+			continue
+		}
+		if err := setField(v.Field(idx), s); err != nil {
+			return m, fmt.Errorf("cannot parse field %q: %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+func setField(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package jsonlfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+
+	"slack2logs/transporter"
+)
+
+const maxLineSize = 16 << 20
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// stdinPath is the path for reading messages from stdin
+const stdinPath = "-"
+
+// Reader reads messages from JSONL files written by Writer
+// or from VictoriaLogs /select/logsql/query responses.
+// Compression is detected automatically.
+type Reader struct {
+	paths []string
+}
+
+// NewReader returns Reader for the given paths.
+// Paths may contain glob patterns. Directories are read recursively.
+// The "-" path means stdin.
+func NewReader(paths []string) (*Reader, error) {
+	var files []string
+	for _, p := range paths {
+		if p == stdinPath {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files found at %q", p)
+		}
+		for _, m := range matches {
+			// WalkDir visits files in lexical order, so files are read in chronological order
+			err := filepath.WalkDir(m, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() || filepath.Ext(path) == tmpFileSuffix {
+					return nil
+				}
+				files = append(files, path)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %q: %w", m, err)
+			}
+		}
+	}
+	return &Reader{paths: files}, nil
+}
+
+// Export reads messages from all the files and sends them via callback
+func (r *Reader) Export(ctx context.Context, cb func(m transporter.Message)) {
+	for _, path := range r.paths {
+		if ctx.Err() != nil {
+			return
+		}
+		n, err := readFile(ctx, path, cb)
+		if err != nil {
+			log.Printf("error read messages from %q: %s", path, err)
+			continue
+		}
+		log.Printf("read %d messages from %q", n, path)
+	}
+}
+
+func readFile(ctx context.Context, path string, cb func(m transporter.Message)) (int, error) {
+	if path == stdinPath {
+		return readMessages(ctx, os.Stdin, cb)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return readMessages(ctx, f, cb)
+}
+
+// readMessages reads newline-delimited messages from r and sends them via callback
+func readMessages(ctx context.Context, r io.Reader, cb func(m transporter.Message)) (int, error) {
+	dr, err := newDecompressor(r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = dr.Close() }()
+
+	sc := bufio.NewScanner(dr)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	n := 0
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		m, err := parseMessage(line)
+		if err != nil {
+			return n, fmt.Errorf("cannot parse line #%d: %w", lineNum, err)
+		}
+		cb(m)
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return n, fmt.Errorf("cannot read messages: %w", err)
+	}
+	return n, nil
+}
+
+// newDecompressor detects compression of r by magic bytes
+// and returns the corresponding decompressing reader
+func newDecompressor(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("cannot read file header: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create gzip reader: %w", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
@@ -0,0 +1,396 @@
+package jsonlfile
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/klauspost/compress/zstd"
+
+	"slack2logs/transporter"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+
+	tmpFileSuffix = ".tmp"
+)
+
+var (
+	dir               = flag.String("jsonlfile.dir", "", "Directory for storing messages in newline-delimited JSON files if -output contains jsonl. Files are stored as <dir>/<channel_id>/<period>_<n>.jsonl[.gz|.zst]")
+	compression       = flag.String("jsonlfile.compression", compressionZstd, "Compression for JSONL files. Supported values: zstd, gzip, none")
+	partitionInterval = flag.Duration("jsonlfile.partitionInterval", 24*time.Hour, "Time interval covered by a single JSONL file. Messages are put into files according to their timestamps")
+	maxFileSize       = flag.Int64("jsonlfile.maxFileSize", 0, "The maximum size in bytes of a single JSONL file on disk. A new file is started when the limit is reached. Zero means no limit")
+	maxOpenFiles      = flag.Int("jsonlfile.maxOpenFiles", 64, "The maximum number of simultaneously open JSONL files. The least recently used file is finalized when the limit is reached")
+	idleTimeout       = flag.Duration("jsonlfile.idleTimeout", 5*time.Minute, "JSONL files without writes during this interval are finalized. "+
+		"Messages may arrive out of order, for example during backfilling, so files aren't finalized right after their period ends")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="jsonlfile"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="jsonlfile"}`)
+	filesRotatedCount     = metrics.GetOrCreateCounter(`vm_slack2logs_jsonlfile_rotations_total`)
+)
+
+// Writer writes messages into rotated newline-delimited JSON files.
+//
+// Files are written with .tmp suffix and atomically renamed when they are finalized,
+// so only complete files are visible under final names.
+type Writer struct {
+	dir               string
+	compression       string
+	partitionInterval time.Duration
+	maxFileSize       int64
+	maxOpenFiles      int
+	idleTimeout       time.Duration
+
+	mu    sync.Mutex
+	files map[fileKey]*file
+
+	// stopC is nil if idle files aren't finalized in background
+	stopC   chan struct{}
+	stopped sync.WaitGroup
+}
+
+type fileKey struct {
+	channelID string
+	period    int64
+}
+
+// file represents an open JSONL file
+type file struct {
+	key       fileKey
+	path      string
+	f         *os.File
+	cw        *countingWriter
+	w         io.WriteCloser
+	lastWrite time.Time
+}
+
+// New returns Writer configured via -jsonlfile.* flags
+func New() (*Writer, error) {
+	if *dir == "" {
+		return nil, fmt.Errorf("-jsonlfile.dir must be set")
+	}
+	switch *compression {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return nil, fmt.Errorf("unsupported -jsonlfile.compression=%q; supported values: %s, %s, %s", *compression, compressionZstd, compressionGzip, compressionNone)
+	}
+	if *partitionInterval <= 0 {
+		return nil, fmt.Errorf("-jsonlfile.partitionInterval must be positive; got %s", *partitionInterval)
+	}
+	if *maxOpenFiles <= 0 {
+		return nil, fmt.Errorf("-jsonlfile.maxOpenFiles must be positive; got %d", *maxOpenFiles)
+	}
+	if *idleTimeout <= 0 {
+		return nil, fmt.Errorf("-jsonlfile.idleTimeout must be positive; got %s", *idleTimeout)
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create -jsonlfile.dir=%q: %w", *dir, err)
+	}
+	if err := recoverTmpFiles(*dir); err != nil {
+		return nil, fmt.Errorf("cannot recover unfinished files in -jsonlfile.dir=%q: %w", *dir, err)
+	}
+	w := &Writer{
+		dir:               *dir,
+		compression:       *compression,
+		partitionInterval: *partitionInterval,
+		maxFileSize:       *maxFileSize,
+		maxOpenFiles:      *maxOpenFiles,
+		idleTimeout:       *idleTimeout,
+		files:             make(map[fileKey]*file),
+		stopC:             make(chan struct{}),
+	}
+	w.stopped.Add(1)
+	go w.finalizeIdleFiles()
+	return w, nil
+}
+
+// recoverTmpFiles finalizes files left with .tmp suffix after a crash, so they are visible to replay.
+// Such files may end with a truncated line or a truncated compressed block,
+// so only the messages before the truncation can be read from them. Empty files are removed.
+func recoverTmpFiles(dir string) error {
+	return filepath.WalkDir(dir, func(tmpPath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(tmpPath) != tmpFileSuffix {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Size() == 0 {
+			log.Printf("removing empty unfinished JSONL file %q", tmpPath)
+			return os.Remove(tmpPath)
+		}
+		path := strings.TrimSuffix(tmpPath, tmpFileSuffix)
+		if fileExists(path) {
+			log.Printf("skipping unfinished JSONL file %q, since %q already exists", tmpPath, path)
+			return nil
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, path, err)
+		}
+		log.Printf("finalized JSONL file %q left unfinished by the previous run; it may end with a truncated message", path)
+		return nil
+	})
+}
+
+// finalizeIdleFiles periodically finalizes files without writes during idleTimeout,
+// so complete files don't stay with .tmp suffix and unflushed compressed data until shutdown
+func (w *Writer) finalizeIdleFiles() {
+	defer w.stopped.Done()
+	ticker := time.NewTicker(max(w.idleTimeout/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopC:
+			return
+		case <-ticker.C:
+			if err := w.finalizeIdle(time.Now()); err != nil {
+				log.Printf("error finalize idle JSONL files: %s", err)
+				handleMessageErrors.Inc()
+			}
+		}
+	}
+}
+
+// finalizeIdle finalizes files, which weren't written since now-idleTimeout
+func (w *Writer) finalizeIdle(now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	deadline := now.Add(-w.idleTimeout)
+	for _, f := range w.files {
+		if f.lastWrite.After(deadline) {
+			continue
+		}
+		if err := w.finalize(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Import writes message to the file for the message channel and time period
+func (w *Writer) Import(_ context.Context, message transporter.Message) error {
+	messagesDeliveryCount.Inc()
+	if err := w.write(message); err != nil {
+		handleMessageErrors.Inc()
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) write(message transporter.Message) error {
+	t, err := message.Time()
+	if err != nil {
+		return fmt.Errorf("cannot parse message timestamp %q: %w", message.TimeStamp, err)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error marshal message when writing to file: %w", err)
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := fileKey{
+		channelID: message.ChannelID,
+		period:    t.Truncate(w.partitionInterval).Unix(),
+	}
+	f, ok := w.files[key]
+	if !ok {
+		if len(w.files) >= w.maxOpenFiles {
+			if err := w.finalize(w.leastRecentlyUsed()); err != nil {
+				return err
+			}
+		}
+		f, err = w.open(key)
+		if err != nil {
+			return err
+		}
+		w.files[key] = f
+	}
+	if _, err := f.w.Write(data); err != nil {
+		return fmt.Errorf("cannot write message to %q: %w", f.path, err)
+	}
+	f.lastWrite = time.Now()
+	if w.maxFileSize > 0 && f.cw.n >= w.maxFileSize {
+		return w.finalize(f)
+	}
+	return nil
+}
+
+// Close finalizes all the open files
+func (w *Writer) Close() error {
+	if w.stopC != nil {
+		close(w.stopC)
+		w.stopped.Wait()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for _, f := range w.files {
+		if err := w.finalize(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Writer) leastRecentlyUsed() *file {
+	var lru *file
+	for _, f := range w.files {
+		if lru == nil || f.lastWrite.Before(lru.lastWrite) {
+			lru = f
+		}
+	}
+	return lru
+}
+
+// open creates a new temporary file for the given key.
+// The file gets the first sequence number, which isn't used by other files of the same period.
+func (w *Writer) open(key fileKey) (*file, error) {
+	channelDir := filepath.Join(w.dir, sanitizeFileName(key.channelID))
+	if err := os.MkdirAll(channelDir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create directory %q: %w", channelDir, err)
+	}
+	period := w.formatPeriod(time.Unix(key.period, 0).UTC())
+	for n := 0; ; n++ {
+		path := filepath.Join(channelDir, fmt.Sprintf("%s_%d%s", period, n, w.fileExtension()))
+		if fileExists(path) || fileExists(path+tmpFileSuffix) {
+			continue
+		}
+		f, err := os.OpenFile(path+tmpFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create file %q: %w", path+tmpFileSuffix, err)
+		}
+		cw := &countingWriter{w: f}
+		fw, err := w.newCompressor(cw)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &file{
+			key:  key,
+			path: path,
+			f:    f,
+			cw:   cw,
+			w:    fw,
+		}, nil
+	}
+}
+
+// finalize closes the file and atomically renames it to the final name
+func (w *Writer) finalize(f *file) error {
+	delete(w.files, f.key)
+	tmpPath := f.path + tmpFileSuffix
+	if err := f.w.Close(); err != nil {
+		_ = f.f.Close()
+		return fmt.Errorf("cannot flush file %q: %w", tmpPath, err)
+	}
+	if err := f.f.Sync(); err != nil {
+		_ = f.f.Close()
+		return fmt.Errorf("cannot sync file %q: %w", tmpPath, err)
+	}
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("cannot close file %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, f.path, err)
+	}
+	filesRotatedCount.Inc()
+	log.Printf("finalized JSONL file %q", f.path)
+	return nil
+}
+
+func (w *Writer) newCompressor(dst io.Writer) (io.WriteCloser, error) {
+	switch w.compression {
+	case compressionGzip:
+		return gzip.NewWriter(dst), nil
+	case compressionZstd:
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create zstd writer: %w", err)
+		}
+		return zw, nil
+	default:
+		return nopCloser{dst}, nil
+	}
+}
+
+func (w *Writer) fileExtension() string {
+	switch w.compression {
+	case compressionGzip:
+		return ".jsonl.gz"
+	case compressionZstd:
+		return ".jsonl.zst"
+	default:
+		return ".jsonl"
+	}
+}
+
+func (w *Writer) formatPeriod(t time.Time) string {
+	if w.partitionInterval%(24*time.Hour) == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15-04-05")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// sanitizeFileName makes s safe for using as a file name
+func sanitizeFileName(s string) string {
+	if s == "" {
+		return "_"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c == '/' || c == '\\' || c == 0 {
+			b[i] = '_'
+		}
+	}
+	if s == "." || s == ".." {
+		return "_"
+	}
+	return string(b)
+}
+
+// countingWriter counts bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+
+	"slack2logs/flagutil"
+	"slack2logs/transporter"
+)
+
+const (
+	acksAll    = "all"
+	acksLeader = "leader"
+	acksNone   = "none"
+)
+
+var (
+	kafkaBrokers  = flagutil.NewArrayString("kafka.brokers", "Kafka broker addresses to send messages to if -output contains kafka, for example localhost:9092")
+	kafkaTopic    = flag.String("kafka.topic", "slack-messages", "Kafka topic to send messages to")
+	kafkaClientID = flag.String("kafka.clientID", "slack2logs", "Client id, which is sent to Kafka brokers")
+	kafkaAcks     = flag.String("kafka.acks", acksAll, "The number of acknowledgements required from Kafka brokers for every message. Supported values: all, leader, none. "+
+		"Idempotent writes are enabled only for acks=all")
+	kafkaUser          = flag.String("kafka.auth.user", "", "Username for SASL/PLAIN authentication in Kafka")
+	kafkaPassword      = flag.String("kafka.auth.password", "", "Password for SASL/PLAIN authentication in Kafka")
+	kafkaTLS           = flag.Bool("kafka.tls", false, "Whether to use TLS for connections to Kafka brokers")
+	kafkaBatchSize     = flag.Int("kafka.batchSize", 1000, "The maximum number of messages produced to Kafka at once")
+	kafkaFlushInterval = flag.Duration("kafka.flushInterval", time.Second, "The maximum interval between producing messages to Kafka if there are pending messages")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="kafka"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="kafka"}`)
+)
+
+// Producer publishes messages as JSON into Kafka topic.
+// Records are keyed by channel id, so messages from the same channel
+// go to the same partition and keep their order.
+// Only records, which failed to be produced, are retried, so records already written to the topic aren't duplicated.
+type Producer struct {
+	client  *kgo.Client
+	topic   string
+	batcher *transporter.Batcher
+}
+
+// New returns Producer configured via -kafka.* flags
+func New() (*Producer, error) {
+	if len(*kafkaBrokers) == 0 {
+		return nil, fmt.Errorf("-kafka.brokers cannot be empty")
+	}
+	if *kafkaTopic == "" {
+		return nil, fmt.Errorf("-kafka.topic cannot be empty")
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(*kafkaBrokers...),
+		kgo.ClientID(*kafkaClientID),
+		kgo.DefaultProduceTopic(*kafkaTopic),
+	}
+	acksOpts, err := parseAcks(*kafkaAcks)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, acksOpts...)
+	if *kafkaUser != "" {
+		opts = append(opts, kgo.SASL(plain.Auth{User: *kafkaUser, Pass: *kafkaPassword}.AsMechanism()))
+	}
+	if *kafkaTLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	return newProducer(*kafkaTopic, *kafkaBatchSize, *kafkaFlushInterval, opts...)
+}
+
+func newProducer(topic string, batchSize int, flushInterval time.Duration, opts ...kgo.Opt) (*Producer, error) {
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error create kafka client: %w", err)
+	}
+	p := &Producer{
+		client: client,
+		topic:  topic,
+	}
+	p.batcher = transporter.NewBatcher(batchSize, flushInterval, p.produce)
+	return p, nil
+}
+
+// parseAcks returns producer options for the given acks value.
+// Idempotent writes require acknowledgements from all in-sync replicas,
+// so they are disabled for other values.
+func parseAcks(acks string) ([]kgo.Opt, error) {
+	switch acks {
+	case acksAll:
+		return []kgo.Opt{kgo.RequiredAcks(kgo.AllISRAcks())}, nil
+	case acksLeader:
+		return []kgo.Opt{kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite()}, nil
+	case acksNone:
+		return []kgo.Opt{kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported -kafka.acks=%q; supported values: %s, %s, %s", acks, acksAll, acksLeader, acksNone)
+	}
+}
+
+// Import adds message to the batch, which is produced
+// to Kafka when it is full or on -kafka.flushInterval
+func (p *Producer) Import(ctx context.Context, message transporter.Message) error {
+	return p.batcher.Add(ctx, message)
+}
+
+// OnDelivered registers f, which is called with messages after they are sent.
+// It implements transporter.DeliveryNotifier.
+func (p *Producer) OnDelivered(f func(messages []transporter.Message)) {
+	p.batcher.OnDelivered(f)
+}
+
+// Close produces pending messages and closes connections to Kafka brokers
+func (p *Producer) Close() error {
+	err := p.batcher.Close()
+	p.client.Close()
+	return err
+}
+
+func (p *Producer) produce(ctx context.Context, messages []transporter.Message) error {
+	messagesDeliveryCount.Add(len(messages))
+	records := make([]*kgo.Record, 0, len(messages))
+	for i := range messages {
+		m := &messages[i]
+		value, err := json.Marshal(m)
+		if err != nil {
+			handleMessageErrors.Add(len(messages))
+			return transporter.Permanent(fmt.Errorf("error marshal message: %w", err))
+		}
+		records = append(records, &kgo.Record{
+			Topic: p.topic,
+			Key:   []byte(m.ChannelID),
+			Value: value,
+		})
+	}
+	// results are returned in the order of records
+	var failed []int
+	var firstErr error
+	for i, r := range p.client.ProduceSync(ctx, records...) {
+		if r.Err != nil {
+			failed = append(failed, i)
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+		}
+	}
+	if firstErr == nil {
+		return nil
+	}
+	handleMessageErrors.Add(len(failed))
+	err := fmt.Errorf("cannot produce %d of %d messages to topic %q: %w", len(failed), len(records), p.topic, firstErr)
+	if len(failed) == len(records) {
+		return err
+	}
+	// franz-go fails all the records buffered for the partition together with the failed one,
+	// so retrying the failed records keeps the order of messages from the same channel
+	return &transporter.PartialError{Failed: failed, Err: err}
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"slack2logs/transporter"
+)
+
+// Test for Producer with in-process Kafka cluster
+func TestProducer(t *testing.T) {
+	const topic = "slack-messages"
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, topic))
+	if err != nil {
+		t.Fatalf("cannot start kafka cluster: %s", err)
+	}
+	defer cluster.Close()
+
+	acksOpts, err := parseAcks(acksAll)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	opts := append([]kgo.Opt{kgo.SeedBrokers(cluster.ListenAddrs()...)}, acksOpts...)
+	p, err := newProducer(topic, 2, time.Hour, opts...)
+	if err != nil {
+		t.Fatalf("cannot create producer: %s", err)
+	}
+	messages := []transporter.Message{
+		{Text: "1", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:00Z"},
+		{Text: "2", ChannelID: "C2", TimeStamp: "2024-01-16T10:00:01Z"},
+		{Text: "3", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:02Z"},
+		{Text: "4", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:03Z"},
+		{Text: "5", ChannelID: "C2", TimeStamp: "2024-01-16T10:00:04Z"},
+	}
+	for _, m := range messages {
+		if err := p.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatalf("cannot create consumer: %s", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got := make(map[string][]string)
+	partitions := make(map[string]int32)
+	for n := 0; n < len(messages); {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("cannot consume all the messages; got %d; want %d", n, len(messages))
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			n++
+			var m transporter.Message
+			if err := json.Unmarshal(r.Value, &m); err != nil {
+				t.Fatalf("cannot unmarshal message: %s", err)
+			}
+			key := string(r.Key)
+			if key != m.ChannelID {
+				t.Fatalf("unexpected record key %q for channel %q", key, m.ChannelID)
+			}
+			if p, ok := partitions[key]; ok && p != r.Partition {
+				t.Fatalf("messages from channel %q are in different partitions: %d and %d", key, p, r.Partition)
+			}
+			partitions[key] = r.Partition
+			got[key] = append(got[key], m.Text)
+		})
+	}
+	if len(got["C1"]) != 3 || got["C1"][0] != "1" || got["C1"][1] != "3" || got["C1"][2] != "4" {
+		t.Fatalf("unexpected messages order for channel C1: %v", got["C1"])
+	}
+	if len(got["C2"]) != 2 || got["C2"][0] != "2" || got["C2"][1] != "5" {
+		t.Fatalf("unexpected messages order for channel C2: %v", got["C2"])
+	}
+}
+
+// Test for parseAcks function
+func TestParseAcks(t *testing.T) {
+	for _, acks := range []string{acksAll, acksLeader, acksNone} {
+		if _, err := parseAcks(acks); err != nil {
+			t.Fatalf("unexpected error for acks %q: %s", acks, err)
+		}
+	}
+	if _, err := parseAcks("1"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported acks")
+	}
+}
@@ -0,0 +1,250 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+
+	"slack2logs/auth"
+	"slack2logs/transporter"
+	"slack2logs/vmlogs"
+)
+
+const (
+	pushPath = "loki/api/v1/push"
+
+	encodingProtobuf = "protobuf"
+	encodingJSON     = "json"
+)
+
+var (
+	lokiAddr          = flag.String("loki.addr", "http://localhost:3100", "Grafana Loki address to send messages to if -output contains loki")
+	lokiUser          = flag.String("loki.auth.user", "", "Username for Grafana Loki HTTP server's Basic Auth.")
+	lokiPassword      = flag.String("loki.auth.password", "", "Password for Grafana Loki HTTP server's Basic Auth.")
+	lokiTenantID      = flag.String("loki.tenantID", "", "Optional tenant id, which is sent in X-Scope-OrgID header to Grafana Loki")
+	lokiEncoding      = flag.String("loki.encoding", encodingProtobuf, "Encoding for Grafana Loki push requests. Supported values: protobuf, json. The protobuf encoding is compressed with snappy")
+	lokiBatchSize     = flag.Int("loki.batchSize", 1000, "The maximum number of messages in a single push request to Grafana Loki")
+	lokiFlushInterval = flag.Duration("loki.flushInterval", 5*time.Second, "The maximum interval between push requests to Grafana Loki if there are pending messages")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="loki"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="loki"}`)
+)
+
+// Client is an HTTP client for pushing
+// messages to Grafana Loki via push API.
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+type Client struct {
+	authCfg    *auth.Config
+	httpClient *http.Client
+	url        *url.URL
+	tenantID   string
+	encoding   string
+	batcher    *transporter.Batcher
+}
+
+// stream represents a set of entries with the same labels
+type stream struct {
+	labels  []transporter.Field
+	entries []entry
+}
+
+// entry represents a single log entry
+type entry struct {
+	timestamp time.Time
+	line      string
+	metadata  []transporter.Field
+}
+
+// New returns Client configured via -loki.* flags
+func New() (*Client, error) {
+	authCfg, err := auth.Generate(auth.WithBasicAuth(*lokiUser, *lokiPassword))
+	if err != nil {
+		return nil, fmt.Errorf("error create loki authentication configuration: %w", err)
+	}
+	switch *lokiEncoding {
+	case encodingProtobuf, encodingJSON:
+	default:
+		return nil, fmt.Errorf("unsupported -loki.encoding=%q; supported values: %s, %s", *lokiEncoding, encodingProtobuf, encodingJSON)
+	}
+	u, err := url.Parse(fmt.Sprintf("%s/%s", strings.TrimSuffix(*lokiAddr, "/"), pushPath))
+	if err != nil {
+		return nil, fmt.Errorf("incorrect push address defined %s: %w", *lokiAddr, err)
+	}
+	c := &Client{
+		authCfg: authCfg,
+		httpClient: &http.Client{
+			Transport: &http.Transport{},
+			Timeout:   30 * time.Second,
+		},
+		url:      u,
+		tenantID: *lokiTenantID,
+		encoding: *lokiEncoding,
+	}
+	c.batcher = transporter.NewBatcher(*lokiBatchSize, *lokiFlushInterval, c.push)
+	return c, nil
+}
+
+// Import adds message to the batch, which is pushed
+// to Grafana Loki when it is full or on -loki.flushInterval
+func (c *Client) Import(ctx context.Context, message transporter.Message) error {
+	return c.batcher.Add(ctx, message)
+}
+
+// OnDelivered registers f, which is called with messages after they are sent.
+// It implements transporter.DeliveryNotifier.
+func (c *Client) OnDelivered(f func(messages []transporter.Message)) {
+	c.batcher.OnDelivered(f)
+}
+
+// Close pushes pending messages to Grafana Loki
+func (c *Client) Close() error {
+	return c.batcher.Close()
+}
+
+func (c *Client) push(ctx context.Context, messages []transporter.Message) error {
+	messagesDeliveryCount.Add(len(messages))
+	streams := groupStreams(messages)
+	if len(streams) == 0 {
+		return nil
+	}
+
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if c.encoding == encodingProtobuf {
+		body = snappy.Encode(nil, marshalProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body, err = marshalJSON(streams)
+		if err != nil {
+			handleMessageErrors.Add(len(messages))
+			return transporter.Permanent(fmt.Errorf("error marshal push request: %w", err))
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.String(), bytes.NewReader(body))
+	if err != nil {
+		handleMessageErrors.Add(len(messages))
+		return fmt.Errorf("error create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.tenantID)
+	}
+	if c.authCfg != nil {
+		c.authCfg.SetHeaders(req, true)
+	}
+	if err := c.do(req); err != nil {
+		handleMessageErrors.Add(len(messages))
+		return err
+	}
+	return nil
+}
+
+func (c *Client) do(req *http.Request) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unexpected error when performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body for status code %d: %s", resp.StatusCode, err)
+		}
+		err = fmt.Errorf("unexpected response code %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			// the request is rejected, so retrying it cannot help
+			return transporter.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// groupStreams groups messages into streams by VictoriaLogs stream fields,
+// which are used as Loki labels. Other message fields except text and ts
+// are sent as structured metadata.
+// See https://grafana.com/docs/loki/latest/get-started/labels/structured-metadata/
+//
+// Messages with invalid timestamps are logged and skipped, so they don't prevent pushing other messages.
+func groupStreams(messages []transporter.Message) []*stream {
+	var streams []*stream
+	byLabels := make(map[string]*stream)
+	for i := range messages {
+		m := &messages[i]
+		t, err := m.Time()
+		if err != nil {
+			log.Printf("skip message %s from channel %q with invalid timestamp %q: %s", m.MessageTS, m.ChannelID, m.TimeStamp, err)
+			handleMessageErrors.Inc()
+			continue
+		}
+		labels, metadata := splitFields(m.Fields())
+		key := formatLabels(labels)
+		s, ok := byLabels[key]
+		if !ok {
+			s = &stream{labels: labels}
+			byLabels[key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, entry{
+			timestamp: t,
+			line:      m.Text,
+			metadata:  metadata,
+		})
+	}
+	return streams
+}
+
+func splitFields(fields []transporter.Field) ([]transporter.Field, []transporter.Field) {
+	var labels, metadata []transporter.Field
+	for _, f := range fields {
+		switch {
+		case f.Name == "text" || f.Name == "ts":
+		case isStreamField(f.Name):
+			labels = append(labels, f)
+		default:
+			metadata = append(metadata, f)
+		}
+	}
+	return labels, metadata
+}
+
+func isStreamField(name string) bool {
+	for _, sf := range vmlogs.StreamFields {
+		if sf == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatLabels returns labels in Prometheus text format, for example {channel_id="C1", channel_name="general"}
+func formatLabels(labels []transporter.Field) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
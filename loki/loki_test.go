@@ -0,0 +1,170 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+	"github.com/golang/snappy"
+
+	"slack2logs/transporter"
+)
+
+var testMessages = []transporter.Message{
+	{Text: "hello", TimeStamp: "2024-01-16T10:00:00Z", ChannelID: "C1", ChannelName: "general", TeamID: "T1", UserID: "U1", ThreadTimeStamp: "1705399200.000100"},
+	{Text: "world", TimeStamp: "2024-01-16T10:00:01Z", ChannelID: "C1", ChannelName: "general", TeamID: "T1", UserID: "U2"},
+	{Text: "other", TimeStamp: "2024-01-16T10:00:02Z", ChannelID: "C2", ChannelName: "random", TeamID: "T1", UserID: "U1"},
+}
+
+func newTestClient(t *testing.T, encoding string, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL + "/" + pushPath)
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+	c := &Client{
+		httpClient: srv.Client(),
+		url:        u,
+		tenantID:   "tenant",
+		encoding:   encoding,
+	}
+	c.batcher = transporter.NewBatcher(len(testMessages), time.Hour, c.push)
+	return c
+}
+
+// Test for Client push in JSON encoding
+func TestClientPushJSON(t *testing.T) {
+	var got jsonPushRequest
+	c := newTestClient(t, encodingJSON, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Errorf("unexpected X-Scope-OrgID header: %q", r.Header.Get("X-Scope-OrgID"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("cannot decode request: %s", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if err := c.push(context.Background(), testMessages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got.Streams) != 2 {
+		t.Fatalf("unexpected number of streams; got %d; want 2", len(got.Streams))
+	}
+	s := got.Streams[0]
+	if s.Stream["channel_id"] != "C1" || s.Stream["channel_name"] != "general" || s.Stream["team_id"] != "T1" || len(s.Stream) != 3 {
+		t.Fatalf("unexpected stream labels: %v", s.Stream)
+	}
+	if len(s.Values) != 2 {
+		t.Fatalf("unexpected number of entries; got %d; want 2", len(s.Values))
+	}
+	if s.Values[0][0] != "1705399200000000000" || s.Values[0][1] != "hello" {
+		t.Fatalf("unexpected entry: %v", s.Values[0])
+	}
+	md, ok := s.Values[0][2].(map[string]any)
+	if !ok || md["user_id"] != "U1" || md["thread_ts"] != "1705399200.000100" || md["text"] != nil {
+		t.Fatalf("unexpected structured metadata: %v", s.Values[0][2])
+	}
+}
+
+// Test for Client push in protobuf encoding
+func TestClientPushProtobuf(t *testing.T) {
+	var labels []string
+	c := newTestClient(t, encodingProtobuf, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected Content-Type header: %q", r.Header.Get("Content-Type"))
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request: %s", err)
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("cannot decompress request: %s", err)
+		}
+		labels = readStreamLabels(t, data)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, m := range testMessages {
+		if err := c.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	want := []string{`{channel_id="C1", channel_name="general", team_id="T1"}`, `{channel_id="C2", channel_name="random", team_id="T1"}`}
+	if len(labels) != len(want) || labels[0] != want[0] || labels[1] != want[1] {
+		t.Fatalf("unexpected stream labels; got %q; want %q", labels, want)
+	}
+}
+
+// Test for Client push error handling
+func TestClientPushError(t *testing.T) {
+	c := newTestClient(t, encodingJSON, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	})
+	if err := c.push(context.Background(), testMessages); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+// Test for Client push skipping messages with invalid timestamps
+func TestClientPushInvalidTimestamp(t *testing.T) {
+	var got jsonPushRequest
+	c := newTestClient(t, encodingJSON, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("cannot decode request: %s", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	messages := append([]transporter.Message{{Text: "bad", TimeStamp: "invalid", ChannelID: "C1", ChannelName: "general"}}, testMessages...)
+	if err := c.push(context.Background(), messages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n := 0
+	for _, s := range got.Streams {
+		for _, v := range s.Values {
+			if v[1] == "bad" {
+				t.Fatalf("unexpected entry with invalid timestamp: %v", v)
+			}
+			n++
+		}
+	}
+	if n != len(testMessages) {
+		t.Fatalf("unexpected number of entries; got %d; want %d", n, len(testMessages))
+	}
+}
+
+func readStreamLabels(t *testing.T, data []byte) []string {
+	t.Helper()
+	var labels []string
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		var err error
+		data, err = fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read PushRequest field: %s", err)
+		}
+		streamData, ok := fc.MessageData()
+		if !ok || fc.FieldNum != 1 {
+			t.Fatalf("unexpected PushRequest field %d", fc.FieldNum)
+		}
+		var sfc easyproto.FieldContext
+		for len(streamData) > 0 {
+			streamData, err = sfc.NextField(streamData)
+			if err != nil {
+				t.Fatalf("cannot read StreamAdapter field: %s", err)
+			}
+			if sfc.FieldNum == 1 {
+				s, _ := sfc.String()
+				labels = append(labels, s)
+			}
+		}
+	}
+	return labels
+}
@@ -0,0 +1,93 @@
+package loki
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+var mp easyproto.MarshalerPool
+
+// marshalProtobuf marshals streams into logproto.PushRequest
+// See https://github.com/grafana/loki/blob/main/pkg/push/push.proto
+//
+//	message PushRequest {
+//	  repeated StreamAdapter streams = 1;
+//	}
+//	message StreamAdapter {
+//	  string labels = 1;
+//	  repeated EntryAdapter entries = 2;
+//	}
+//	message EntryAdapter {
+//	  google.protobuf.Timestamp timestamp = 1;
+//	  string line = 2;
+//	  repeated LabelPairAdapter structuredMetadata = 3;
+//	}
+//	message LabelPairAdapter {
+//	  string name = 1;
+//	  string value = 2;
+//	}
+func marshalProtobuf(streams []*stream) []byte {
+	m := mp.Get()
+	defer mp.Put(m)
+
+	req := m.MessageMarshaler()
+	for _, s := range streams {
+		sm := req.AppendMessage(1)
+		sm.AppendString(1, formatLabels(s.labels))
+		for _, e := range s.entries {
+			em := sm.AppendMessage(2)
+			ts := em.AppendMessage(1)
+			ts.AppendInt64(1, e.timestamp.Unix())
+			ts.AppendInt32(2, int32(e.timestamp.Nanosecond()))
+			em.AppendString(2, e.line)
+			for _, md := range e.metadata {
+				mdm := em.AppendMessage(3)
+				mdm.AppendString(1, md.Name)
+				mdm.AppendString(2, md.Value)
+			}
+		}
+	}
+	return m.Marshal(nil)
+}
+
+// jsonPushRequest represents push request in JSON format
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+type jsonPushRequest struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values contains [<unix epoch in nanoseconds>, <log line>, <structured metadata>] tuples
+	Values [][]any `json:"values"`
+}
+
+func marshalJSON(streams []*stream) ([]byte, error) {
+	req := jsonPushRequest{
+		Streams: make([]jsonStream, 0, len(streams)),
+	}
+	for _, s := range streams {
+		js := jsonStream{
+			Stream: make(map[string]string, len(s.labels)),
+			Values: make([][]any, 0, len(s.entries)),
+		}
+		for _, l := range s.labels {
+			js.Stream[l.Name] = l.Value
+		}
+		for _, e := range s.entries {
+			value := []any{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line}
+			if len(e.metadata) > 0 {
+				md := make(map[string]string, len(e.metadata))
+				for _, f := range e.metadata {
+					md[f.Name] = f.Value
+				}
+				value = append(value, md)
+			}
+			js.Values = append(js.Values, value)
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
@@ -13,9 +13,10 @@ import (
 	"slack2logs/envflag"
 	"slack2logs/flagutil"
 	"slack2logs/httpserver"
+	"slack2logs/output"
 	"slack2logs/slack"
 	"slack2logs/transporter"
-	"slack2logs/vmlogs"
+	"slack2logs/verify"
 )
 
 func main() {
@@ -26,21 +27,34 @@ func main() {
 	// Create a context that can be used to cancel goroutine
 	ctx, cancel := context.WithCancel(context.Background())
 
-	log.Println("Init slack client")
-	slackClient := slack.New()
-	go func() {
-		log.Println("Start listen message in the channels")
-		if err := slackClient.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
-			log.Fatalf("error run slack client: %s", err)
+	log.Println("Init slack clients")
+	slackClients := slack.NewClients()
+	exporters := make(transporter.MultiExporter, 0, len(slackClients))
+	for _, slackClient := range slackClients {
+		go func(slackClient *slack.Client) {
+			log.Println("Start listen message in the channels")
+			if err := slackClient.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Fatalf("error run slack client: %s", err)
+			}
+		}(slackClient)
+		if path, h := slackClient.EventsHandler(); h != nil {
+			httpserver.Handle(path, h)
 		}
-	}()
-	log.Println("Init vmlogs client")
-	logs, err := vmlogs.New()
+		exporters = append(exporters, slackClient)
+	}
+	job, err := verify.NewJob(slackClients)
+	if err != nil {
+		log.Fatalf("error initialize verification job: %s", err)
+	}
+	if job != nil {
+		exporters = append(exporters, job)
+	}
+	logs, err := output.New()
 	if err != nil {
-		log.Fatalf("error initialize VictoriaLogs client: %s", err)
+		log.Fatalf("error initialize output: %s", err)
 	}
 
-	trp := transporter.New(slackClient, logs)
+	trp := transporter.New(exporters, logs)
 
 	go httpserver.Serve()
 
@@ -0,0 +1,90 @@
+package otlp
+
+import (
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"slack2logs/transporter"
+)
+
+const (
+	scopeName = "slack2logs"
+	// severityNumberInfo is SEVERITY_NUMBER_INFO
+	severityNumberInfo = 9
+)
+
+var mp easyproto.MarshalerPool
+
+// marshalExportLogsServiceRequest marshals resources into ExportLogsServiceRequest.
+// observedTime is the time when the records are sent, while time_unix_nano is the message time.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/logs/v1/logs_service.proto
+//
+//	message ExportLogsServiceRequest {
+//	  repeated ResourceLogs resource_logs = 1;
+//	}
+//	message ResourceLogs {
+//	  Resource resource = 1;
+//	  repeated ScopeLogs scope_logs = 2;
+//	}
+//	message Resource {
+//	  repeated KeyValue attributes = 1;
+//	}
+//	message ScopeLogs {
+//	  InstrumentationScope scope = 1;
+//	  repeated LogRecord log_records = 2;
+//	}
+//	message InstrumentationScope {
+//	  string name = 1;
+//	}
+//	message LogRecord {
+//	  fixed64 time_unix_nano = 1;
+//	  SeverityNumber severity_number = 2;
+//	  string severity_text = 3;
+//	  AnyValue body = 5;
+//	  repeated KeyValue attributes = 6;
+//	  fixed64 observed_time_unix_nano = 11;
+//	}
+//	message KeyValue {
+//	  string key = 1;
+//	  AnyValue value = 2;
+//	}
+//	message AnyValue {
+//	  string string_value = 1;
+//	}
+func marshalExportLogsServiceRequest(resources []*resourceLogs, observedTime time.Time) []byte {
+	m := mp.Get()
+	defer mp.Put(m)
+
+	observed := uint64(observedTime.UnixNano())
+	req := m.MessageMarshaler()
+	for _, rl := range resources {
+		rlm := req.AppendMessage(1)
+		resource := rlm.AppendMessage(1)
+		appendAttributes(resource, 1, rl.attributes)
+
+		sl := rlm.AppendMessage(2)
+		scope := sl.AppendMessage(1)
+		scope.AppendString(1, scopeName)
+		for _, r := range rl.records {
+			lr := sl.AppendMessage(2)
+			lr.AppendFixed64(1, uint64(r.timestamp.UnixNano()))
+			lr.AppendInt32(2, severityNumberInfo)
+			lr.AppendString(3, "INFO")
+			body := lr.AppendMessage(5)
+			body.AppendString(1, r.body)
+			appendAttributes(lr, 6, r.attributes)
+			lr.AppendFixed64(11, observed)
+		}
+	}
+	return m.Marshal(nil)
+}
+
+func appendAttributes(mm *easyproto.MessageMarshaler, fieldNum uint32, attrs []transporter.Field) {
+	for _, a := range attrs {
+		kv := mm.AppendMessage(fieldNum)
+		kv.AppendString(1, a.Name)
+		value := kv.AppendMessage(2)
+		value.AppendString(1, a.Value)
+	}
+}
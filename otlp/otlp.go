@@ -0,0 +1,218 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/flagutil"
+	"slack2logs/transporter"
+)
+
+var (
+	otlpEndpoint = flag.String("otlp.endpoint", "http://localhost:4318/v1/logs", "OTLP/HTTP logs endpoint to send messages to if -output contains otlp. "+
+		"For example, http://victorialogs:9428/insert/opentelemetry/v1/logs for VictoriaLogs")
+	otlpHeaders       = flagutil.NewArrayString("otlp.headers", "Optional HTTP headers to send with every OTLP request in the form 'Name: value', for example 'Authorization: Bearer token'")
+	otlpBatchSize     = flag.Int("otlp.batchSize", 1000, "The maximum number of messages in a single OTLP request")
+	otlpFlushInterval = flag.Duration("otlp.flushInterval", 5*time.Second, "The maximum interval between OTLP requests if there are pending messages")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="otlp"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="otlp"}`)
+)
+
+// resourceFields contains message fields, which are sent as resource attributes.
+// The rest of the fields except text are sent as log record attributes.
+var resourceFields = map[string]struct{}{
+	"channel_id":   {},
+	"channel_name": {},
+	"team_id":      {},
+	"team_name":    {},
+}
+
+// Client is an HTTP client for sending messages
+// as OpenTelemetry log records via OTLP/HTTP protobuf.
+// See https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type Client struct {
+	httpClient *http.Client
+	url        *url.URL
+	headers    http.Header
+	batcher    *transporter.Batcher
+}
+
+// resourceLogs represents log records with the same resource attributes
+type resourceLogs struct {
+	attributes []transporter.Field
+	records    []logRecord
+}
+
+// logRecord represents a single OpenTelemetry log record
+type logRecord struct {
+	timestamp  time.Time
+	body       string
+	attributes []transporter.Field
+}
+
+// New returns Client configured via -otlp.* flags
+func New() (*Client, error) {
+	u, err := url.Parse(*otlpEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect -otlp.endpoint=%q: %w", *otlpEndpoint, err)
+	}
+	headers := make(http.Header)
+	for _, h := range *otlpHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("incorrect -otlp.headers=%q; want 'Name: value'", h)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	c := &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{},
+			Timeout:   30 * time.Second,
+		},
+		url:     u,
+		headers: headers,
+	}
+	c.batcher = transporter.NewBatcher(*otlpBatchSize, *otlpFlushInterval, c.send)
+	return c, nil
+}
+
+// Import adds message to the batch, which is sent
+// when it is full or on -otlp.flushInterval
+func (c *Client) Import(ctx context.Context, message transporter.Message) error {
+	return c.batcher.Add(ctx, message)
+}
+
+// OnDelivered registers f, which is called with messages after they are sent.
+// It implements transporter.DeliveryNotifier.
+func (c *Client) OnDelivered(f func(messages []transporter.Message)) {
+	c.batcher.OnDelivered(f)
+}
+
+// Close sends pending messages
+func (c *Client) Close() error {
+	return c.batcher.Close()
+}
+
+func (c *Client) send(ctx context.Context, messages []transporter.Message) error {
+	messagesDeliveryCount.Add(len(messages))
+	resources := groupResources(messages)
+	if len(resources) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(marshalExportLogsServiceRequest(resources, time.Now())); err != nil {
+		handleMessageErrors.Add(len(messages))
+		return fmt.Errorf("error compress request: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		handleMessageErrors.Add(len(messages))
+		return fmt.Errorf("error compress request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.String(), &buf)
+	if err != nil {
+		handleMessageErrors.Add(len(messages))
+		return fmt.Errorf("error create export request: %w", err)
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	if err := c.do(req); err != nil {
+		handleMessageErrors.Add(len(messages))
+		return err
+	}
+	return nil
+}
+
+func (c *Client) do(req *http.Request) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unexpected error when performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body for status code %d: %s", resp.StatusCode, err)
+		}
+		err = fmt.Errorf("unexpected response code %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			// the request is rejected, so retrying it cannot help
+			return transporter.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// groupResources groups messages by resource attributes.
+// Messages with invalid timestamps are logged and skipped, so they don't prevent sending other messages.
+func groupResources(messages []transporter.Message) []*resourceLogs {
+	var resources []*resourceLogs
+	byKey := make(map[string]*resourceLogs)
+	for i := range messages {
+		m := &messages[i]
+		t, err := m.Time()
+		if err != nil {
+			log.Printf("skip message %s from channel %q with invalid timestamp %q: %s", m.MessageTS, m.ChannelID, m.TimeStamp, err)
+			handleMessageErrors.Inc()
+			continue
+		}
+		var resourceAttrs, attrs []transporter.Field
+		for _, f := range m.Fields() {
+			switch {
+			case f.Name == "text", f.Name == "ts":
+				// text is sent as the body and ts as time_unix_nano
+			case isResourceField(f.Name):
+				resourceAttrs = append(resourceAttrs, f)
+			default:
+				attrs = append(attrs, f)
+			}
+		}
+		key := resourceKey(resourceAttrs)
+		rl, ok := byKey[key]
+		if !ok {
+			rl = &resourceLogs{attributes: resourceAttrs}
+			byKey[key] = rl
+			resources = append(resources, rl)
+		}
+		rl.records = append(rl.records, logRecord{
+			timestamp:  t,
+			body:       m.Text,
+			attributes: attrs,
+		})
+	}
+	return resources
+}
+
+func isResourceField(name string) bool {
+	_, ok := resourceFields[name]
+	return ok
+}
+
+func resourceKey(attrs []transporter.Field) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		fmt.Fprintf(&b, "%q=%q,", a.Name, a.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,221 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"slack2logs/transporter"
+)
+
+var testMessages = []transporter.Message{
+	{Text: "hello", TimeStamp: "2024-01-16T10:00:00.0001Z", ChannelID: "C1", ChannelName: "general", TeamID: "T1", UserID: "U1", ThreadTimeStamp: "1705399200.000100"},
+	{Text: "world", TimeStamp: "2024-01-16T10:00:01Z", ChannelID: "C1", ChannelName: "general", TeamID: "T1", UserID: "U2"},
+	{Text: "other", TimeStamp: "2024-01-16T10:00:02Z", ChannelID: "C2", ChannelName: "random", TeamID: "T1", UserID: "U1"},
+}
+
+// exportedLog is a log record decoded from ExportLogsServiceRequest
+type exportedLog struct {
+	resource     map[string]string
+	timestamp    uint64
+	observedTime uint64
+	body         string
+	attributes   map[string]string
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL + "/v1/logs")
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+	return &Client{
+		httpClient: srv.Client(),
+		url:        u,
+		headers:    http.Header{"Authorization": {"Bearer token"}},
+	}
+}
+
+// Test for Client send
+func TestClientSend(t *testing.T) {
+	var got []exportedLog
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected Authorization header: %q", r.Header.Get("Authorization"))
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("cannot decompress request: %s", err)
+			return
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("cannot read request: %s", err)
+			return
+		}
+		got = readExportLogsServiceRequest(t, data)
+	})
+	start := uint64(time.Now().UnixNano())
+	if err := c.send(context.Background(), testMessages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != len(testMessages) {
+		t.Fatalf("unexpected number of log records; got %d; want %d", len(got), len(testMessages))
+	}
+	l := got[0]
+	if l.resource["channel_id"] != "C1" || l.resource["channel_name"] != "general" || l.resource["team_id"] != "T1" || len(l.resource) != 3 {
+		t.Fatalf("unexpected resource attributes: %v", l.resource)
+	}
+	if l.body != "hello" || l.timestamp != 1705399200000100000 {
+		t.Fatalf("unexpected log record: %+v", l)
+	}
+	if l.observedTime < start {
+		t.Fatalf("expecting observed time to be the send time; got %d; want at least %d", l.observedTime, start)
+	}
+	if _, ok := l.attributes["ts"]; ok {
+		t.Fatalf("unexpected ts attribute: %v", l.attributes)
+	}
+	if l.attributes["user_id"] != "U1" || l.attributes["thread_ts"] != "1705399200.000100" || l.attributes["text"] != "" || l.attributes["channel_id"] != "" {
+		t.Fatalf("unexpected log attributes: %v", l.attributes)
+	}
+	if got[2].resource["channel_id"] != "C2" {
+		t.Fatalf("unexpected resource attributes: %v", got[2].resource)
+	}
+}
+
+// Test for Client send error handling
+func TestClientSendError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	if err := c.send(context.Background(), testMessages); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+// Test for Client send skipping messages with invalid timestamps
+func TestClientSendInvalidTimestamp(t *testing.T) {
+	var got []exportedLog
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("cannot decompress request: %s", err)
+			return
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("cannot read request: %s", err)
+			return
+		}
+		got = readExportLogsServiceRequest(t, data)
+	})
+	messages := append([]transporter.Message{{Text: "bad", TimeStamp: "invalid", ChannelID: "C1", TeamID: "T1"}}, testMessages...)
+	if err := c.send(context.Background(), messages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != len(testMessages) {
+		t.Fatalf("unexpected number of log records; got %d; want %d", len(got), len(testMessages))
+	}
+	for _, l := range got {
+		if l.body == "bad" {
+			t.Fatalf("unexpected log record with invalid timestamp: %+v", l)
+		}
+	}
+}
+
+func readExportLogsServiceRequest(t *testing.T, data []byte) []exportedLog {
+	t.Helper()
+	var logs []exportedLog
+	forEachField(t, data, func(fc *easyproto.FieldContext) {
+		rlData, _ := fc.MessageData()
+		var resource map[string]string
+		forEachField(t, rlData, func(fc *easyproto.FieldContext) {
+			msgData, _ := fc.MessageData()
+			switch fc.FieldNum {
+			case 1:
+				resource = readAttributes(t, msgData, 1)
+			case 2:
+				forEachField(t, msgData, func(fc *easyproto.FieldContext) {
+					if fc.FieldNum != 2 {
+						return
+					}
+					lrData, _ := fc.MessageData()
+					l := exportedLog{resource: resource}
+					forEachField(t, lrData, func(fc *easyproto.FieldContext) {
+						switch fc.FieldNum {
+						case 1:
+							l.timestamp, _ = fc.Fixed64()
+						case 11:
+							l.observedTime, _ = fc.Fixed64()
+						case 5:
+							body, _ := fc.MessageData()
+							l.body = readAnyValue(t, body)
+						}
+					})
+					l.attributes = readAttributes(t, lrData, 6)
+					logs = append(logs, l)
+				})
+			}
+		})
+	})
+	return logs
+}
+
+func readAttributes(t *testing.T, data []byte, fieldNum uint32) map[string]string {
+	t.Helper()
+	attrs := make(map[string]string)
+	forEachField(t, data, func(fc *easyproto.FieldContext) {
+		if fc.FieldNum != fieldNum {
+			return
+		}
+		kvData, _ := fc.MessageData()
+		var key, value string
+		forEachField(t, kvData, func(fc *easyproto.FieldContext) {
+			switch fc.FieldNum {
+			case 1:
+				key, _ = fc.String()
+			case 2:
+				v, _ := fc.MessageData()
+				value = readAnyValue(t, v)
+			}
+		})
+		attrs[key] = value
+	})
+	return attrs
+}
+
+func readAnyValue(t *testing.T, data []byte) string {
+	t.Helper()
+	var s string
+	forEachField(t, data, func(fc *easyproto.FieldContext) {
+		if fc.FieldNum == 1 {
+			s, _ = fc.String()
+		}
+	})
+	return s
+}
+
+func forEachField(t *testing.T, data []byte, f func(fc *easyproto.FieldContext)) {
+	t.Helper()
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		var err error
+		data, err = fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read protobuf field: %s", err)
+		}
+		f(&fc)
+	}
+}
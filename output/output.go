@@ -0,0 +1,125 @@
+package output
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"slack2logs/dedup"
+	"slack2logs/elasticsearch"
+	"slack2logs/flagutil"
+	"slack2logs/jsonlfile"
+	"slack2logs/kafka"
+	"slack2logs/loki"
+	"slack2logs/otlp"
+	"slack2logs/syslog"
+	"slack2logs/transporter"
+	"slack2logs/vmlogs"
+	"slack2logs/webhook"
+)
+
+const (
+	outputVMLogs        = "vmlogs"
+	outputJSONLFile     = "jsonl"
+	outputLoki          = "loki"
+	outputElasticsearch = "elasticsearch"
+	outputOTLP          = "otlp"
+	outputKafka         = "kafka"
+	outputWebhook       = "webhook"
+	outputSyslog        = "syslog"
+)
+
+var supportedOutputs = []string{outputVMLogs, outputJSONLFile, outputLoki, outputElasticsearch, outputOTLP, outputKafka, outputWebhook, outputSyslog}
+
+var outputs = flagutil.NewArrayString("output", "Destinations for collected messages. Supported values: "+strings.Join(supportedOutputs, ", ")+". "+
+	"Messages are sent to all the defined destinations. Defaults to vmlogs if empty")
+
+// New returns importer for destinations defined via -output flag.
+// Already delivered messages are skipped if it is enabled via -dedup.* flags.
+func New() (transporter.Importer, error) {
+	importer, err := newOutputs()
+	if err != nil {
+		return nil, err
+	}
+	return dedup.Wrap(importer)
+}
+
+func newOutputs() (transporter.Importer, error) {
+	names := *outputs
+	if len(names) == 0 {
+		names = []string{outputVMLogs}
+	}
+	importers := make(transporter.MultiImporter, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("duplicate -output=%q", name)
+		}
+		seen[name] = struct{}{}
+		importer, err := newImporter(name)
+		if err != nil {
+			return nil, err
+		}
+		importers = append(importers, importer)
+	}
+	if len(importers) == 1 {
+		return importers[0], nil
+	}
+	return importers, nil
+}
+
+func newImporter(name string) (transporter.Importer, error) {
+	log.Printf("Init %s output", name)
+	switch name {
+	case outputVMLogs:
+		logs, err := vmlogs.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize VictoriaLogs client: %w", err)
+		}
+		return logs, nil
+	case outputJSONLFile:
+		w, err := jsonlfile.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize JSONL file writer: %w", err)
+		}
+		return w, nil
+	case outputLoki:
+		c, err := loki.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize Grafana Loki client: %w", err)
+		}
+		return c, nil
+	case outputElasticsearch:
+		c, err := elasticsearch.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize Elasticsearch client: %w", err)
+		}
+		return c, nil
+	case outputOTLP:
+		c, err := otlp.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize OTLP client: %w", err)
+		}
+		return c, nil
+	case outputKafka:
+		p, err := kafka.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize Kafka producer: %w", err)
+		}
+		return p, nil
+	case outputWebhook:
+		c, err := webhook.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize webhook client: %w", err)
+		}
+		return c, nil
+	case outputSyslog:
+		c, err := syslog.New()
+		if err != nil {
+			return nil, fmt.Errorf("error initialize syslog client: %w", err)
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unsupported -output=%q; supported values: %s", name, strings.Join(supportedOutputs, ", "))
+	}
+}
@@ -0,0 +1,287 @@
+package slack
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/slack-go/slack"
+
+	"slack2logs/flagutil"
+	"slack2logs/transporter"
+)
+
+var (
+	archivePaths    = flagutil.NewArrayString("slack.archive.path", "Paths to Slack workspace export ZIP archives to import messages from")
+	archiveChannels = flagutil.NewArrayString("slack.archive.channels", "Optional channel ids or names to import from Slack export archives. All the channels are imported if empty")
+	archiveTeamID   = flag.String("slack.archive.teamID", "", "Team id of the workspace the Slack export archives are made for. It is used as team_id of the imported messages, "+
+		"so they match messages collected via Slack API. The most frequent team_id of users from users.json of the archive is used if empty")
+	archiveTeamName = flag.String("slack.archive.teamName", "", "Optional name of the workspace the Slack export archives are made for. It is used as team_name of the imported messages")
+)
+
+var (
+	archiveMessagesCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_received_total{source="slack_archive"}`)
+	archiveErrors        = metrics.GetOrCreateCounter(`vm_slack2logs_errors_total{source="slack_archive"}`)
+)
+
+// conversation files in the Slack export archive.
+// Directories with messages of public channels, private channels and multi-person DMs
+// are named after conversation names, while directories of DMs are named after ids.
+var archiveConversationFiles = []string{"channels.json", "groups.json", "mpims.json", "dms.json"}
+
+// archiveConversationTypes maps conversation files to conversation types
+var archiveConversationTypes = map[string]string{
+	"channels.json": conversationPublic,
+	"groups.json":   conversationPrivate,
+	"mpims.json":    conversationMPIM,
+	"dms.json":      conversationIM,
+}
+
+// ArchiveExporter reads messages from Slack workspace export ZIP archives
+// See https://slack.com/help/articles/220556107-How-to-read-Slack-data-exports
+type ArchiveExporter struct {
+	paths    []string
+	channels map[string]struct{}
+	// teamID and teamName identify the exported workspace. teamID is obtained from users.json if it is empty
+	teamID   string
+	teamName string
+}
+
+// archiveConversation represents a conversation in the Slack export archive
+type archiveConversation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// typ is obtained from the name of the file the conversation is listed in
+	typ string
+}
+
+// NewArchiveExporter returns exporter for archives defined via -slack.archive.path
+func NewArchiveExporter() *ArchiveExporter {
+	if len(*archivePaths) == 0 {
+		log.Fatalf("at least one Slack export archive must be defined via -slack.archive.path")
+	}
+	e := &ArchiveExporter{
+		paths:    *archivePaths,
+		channels: make(map[string]struct{}, len(*archiveChannels)),
+		teamID:   *archiveTeamID,
+		teamName: *archiveTeamName,
+	}
+	for _, ch := range *archiveChannels {
+		e.channels[ch] = struct{}{}
+	}
+	mustInitPolicy()
+	return e
+}
+
+// Export reads messages from all the archives and sends them via callback
+func (e *ArchiveExporter) Export(ctx context.Context, cb func(m transporter.Message)) {
+	for _, p := range e.paths {
+		log.Printf("start import Slack export archive %q", p)
+		startTime := time.Now()
+		n, err := e.exportArchive(ctx, p, cb)
+		if err != nil {
+			log.Printf("error import Slack export archive %q: %s", p, err)
+			archiveErrors.Inc()
+			continue
+		}
+		log.Printf("imported %d messages from Slack export archive %q in %s", n, p, time.Since(startTime))
+	}
+}
+
+func (e *ArchiveExporter) exportArchive(ctx context.Context, archivePath string, cb func(m transporter.Message)) (int, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	users := make(map[string]slack.User)
+	if f, ok := files["users.json"]; ok {
+		var list []slack.User
+		if err := readArchiveFile(f, &list); err != nil {
+			return 0, err
+		}
+		for _, u := range list {
+			users[u.ID] = u
+		}
+	}
+	ws, err := e.workspace(users)
+	if err != nil {
+		return 0, err
+	}
+
+	// conversations maps directory names to conversations
+	conversations := make(map[string]archiveConversation)
+	for _, name := range archiveConversationFiles {
+		f, ok := files[name]
+		if !ok {
+			continue
+		}
+		var list []archiveConversation
+		if err := readArchiveFile(f, &list); err != nil {
+			return 0, err
+		}
+		for _, conv := range list {
+			conv.typ = archiveConversationTypes[name]
+			dir := conv.Name
+			if dir == "" {
+				dir = conv.ID
+			}
+			conversations[dir] = conv
+		}
+	}
+	if len(conversations) == 0 {
+		return 0, fmt.Errorf("no conversations found; the archive must contain at least one of %s", strings.Join(archiveConversationFiles, ", "))
+	}
+
+	// day files are named as <conversation>/<YYYY-MM-DD>.json,
+	// sort them in order to import messages in chronological order
+	var dayFiles []*zip.File
+	for _, f := range zr.File {
+		dir, name := path.Split(f.Name)
+		if dir == "" || path.Ext(name) != ".json" {
+			continue
+		}
+		dayFiles = append(dayFiles, f)
+	}
+	sort.Slice(dayFiles, func(i, j int) bool {
+		return dayFiles[i].Name < dayFiles[j].Name
+	})
+
+	n := 0
+	for _, f := range dayFiles {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		dir := path.Dir(f.Name)
+		conv, ok := conversations[dir]
+		if !ok {
+			log.Printf("skipping file %q: unknown conversation %q", f.Name, dir)
+			continue
+		}
+		if !e.isExported(conv) || !dmAllowed(conv.ID, conv.typ) {
+			continue
+		}
+		var messages []userMessage
+		if err := readArchiveFile(f, &messages); err != nil {
+			log.Printf("skipping file: %s", err)
+			archiveErrors.Inc()
+			continue
+		}
+		for _, am := range messages {
+			archiveMessagesCount.Inc()
+			m, ok, err := convertArchiveMessage(ws, conv, users, am)
+			if err != nil {
+				log.Printf("error convert message from file %q: %s", f.Name, err)
+				archiveErrors.Inc()
+				continue
+			}
+			if !ok {
+				continue
+			}
+			cb(m)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (e *ArchiveExporter) isExported(conv archiveConversation) bool {
+	if len(e.channels) == 0 {
+		return true
+	}
+	if _, ok := e.channels[conv.ID]; ok {
+		return true
+	}
+	_, ok := e.channels[conv.Name]
+	return ok
+}
+
+// workspace returns the exported workspace.
+//
+// Export archives don't contain workspace info, while team of the message is the team of its author,
+// which differs from the workspace team in Slack Connect channels or is missing at all.
+// So the team is obtained from -slack.archive.teamID or from the members of the workspace listed in users.json.
+func (e *ArchiveExporter) workspace(users map[string]slack.User) (*workspace, error) {
+	ws := &workspace{
+		teamID:   e.teamID,
+		teamName: e.teamName,
+		url:      *workspaceURL,
+	}
+	if ws.teamID != "" {
+		return ws, nil
+	}
+	counts := make(map[string]int)
+	for _, u := range users {
+		if u.TeamID != "" {
+			counts[u.TeamID]++
+		}
+	}
+	for teamID, n := range counts {
+		if n > counts[ws.teamID] || n == counts[ws.teamID] && teamID < ws.teamID {
+			ws.teamID = teamID
+		}
+	}
+	if ws.teamID == "" {
+		return nil, fmt.Errorf("cannot determine team id of the workspace from users.json; set it via -slack.archive.teamID")
+	}
+	return ws, nil
+}
+
+// convertArchiveMessage converts message from the archive in the same way as convertHistoryMessage,
+// so system messages about channel changes are converted into channel events.
+// It returns false if the message must be dropped according to filters and policies.
+func convertArchiveMessage(ws *workspace, conv archiveConversation, users map[string]slack.User, am userMessage) (transporter.Message, bool, error) {
+	var user *slack.User
+	if u, ok := users[am.User]; ok {
+		user = &u
+	} else if am.UserProfile != nil {
+		// external users from shared channels are missing in users.json
+		user = embeddedUser(am.User, am.UserTeam, am.UserProfile)
+	}
+	if ev, ok := systemEventFromMessage(conv.ID, &am.Msg); ok {
+		if !globalPolicy.allow(conv.ID, am.User, false) {
+			return transporter.Message{}, false, nil
+		}
+		m, err := newChannelEventMessage(ws, conv.Name, user, ev)
+		if err != nil {
+			return transporter.Message{}, false, fmt.Errorf("error build %s event: %w", ev.typ, err)
+		}
+		m.ConversationType = conv.typ
+		return m, true, nil
+	}
+	if !globalPolicy.allow(conv.ID, am.User, isFiltered(conv.ID, &am.Msg)) {
+		return transporter.Message{}, false, nil
+	}
+	m, err := newMessage(ws, conv.ID, conv.Name, user, botFromProfile(&am.Msg), &am.Msg)
+	if err != nil {
+		return transporter.Message{}, false, err
+	}
+	m.ConversationType = conv.typ
+	return m, true, nil
+}
+
+func readArchiveFile(f *zip.File, dst any) error {
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", f.Name, err)
+	}
+	defer func() { _ = r.Close() }()
+	if err := json.NewDecoder(r).Decode(dst); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", f.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"slack2logs/transporter"
+)
+
+func writeTestArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("cannot create archive: %s", err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("cannot create file %q in archive: %s", name, err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatalf("cannot write file %q to archive: %s", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close archive: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close archive file: %s", err)
+	}
+	return path
+}
+
+// Test for ArchiveExporter.Export method
+func TestArchiveExporter(t *testing.T) {
+	path := writeTestArchive(t, map[string]string{
+		"users.json":    `[{"id":"U1","team_id":"T1","profile":{"display_name":"Alice","display_name_normalized":"alice"}}]`,
+		"channels.json": `[{"id":"C1","name":"general"},{"id":"C2","name":"random"}]`,
+		"general/2024-01-16.json": `[
+			{"type":"message","user":"U1","text":"root","ts":"1705467634.457089","thread_ts":"1705467634.457089","reply_count":1,"team":"T1"},
+			{"type":"message","user":"U2","text":"reply","ts":"1705467700.000100","thread_ts":"1705467634.457089","parent_user_id":"U1","user_profile":{"display_name":"Bob"},"user_team":"T2","team":"T2"}
+		]`,
+		"random/2024-01-16.json": `[{"type":"message","user":"U1","text":"skipped","ts":"1705467634.000001"}]`,
+	})
+	e := &ArchiveExporter{
+		paths:    []string{path},
+		channels: map[string]struct{}{"general": {}},
+	}
+	var got []transporter.Message
+	e.Export(context.Background(), func(m transporter.Message) {
+		got = append(got, m)
+	})
+	if len(got) != 2 {
+		t.Fatalf("unexpected number of messages; got %d; want 2", len(got))
+	}
+	root, reply := got[0], got[1]
+	if root.ChannelID != "C1" || root.ChannelName != "general" || root.DisplayName != "Alice" || root.TeamID != "T1" || root.ConversationType != conversationPublic {
+		t.Fatalf("unexpected root message: %+v", root)
+	}
+	// the workspace team is obtained from users.json, while the team of the message is the team of the external author
+	if reply.DisplayName != "Bob" || reply.ThreadTimeStamp != root.ThreadTimeStamp || reply.ThreadID != root.ThreadID || reply.TeamID != "T1" || !reply.IsExternal {
+		t.Fatalf("unexpected reply message: %+v", reply)
+	}
+}
+
+// Test for exporting direct messages from archives
+func TestArchiveExporterDMs(t *testing.T) {
+	path := writeTestArchive(t, map[string]string{
+		"dms.json":           `[{"id":"D1"},{"id":"D2"}]`,
+		"D1/2024-01-16.json": `[{"type":"message","user":"U1","text":"allowed","ts":"1705467634.000001"}]`,
+		"D2/2024-01-16.json": `[{"type":"message","user":"U1","text":"not allowed","ts":"1705467634.000002"}]`,
+	})
+	origDMs := *dmsIncludeChannels
+	defer func() { *dmsIncludeChannels = origDMs }()
+	*dmsIncludeChannels = []string{"D1"}
+
+	e := &ArchiveExporter{paths: []string{path}, teamID: "T1"}
+	var got []transporter.Message
+	e.Export(context.Background(), func(m transporter.Message) {
+		got = append(got, m)
+	})
+	if len(got) != 1 {
+		t.Fatalf("unexpected number of messages; got %d; want 1", len(got))
+	}
+	if got[0].ChannelID != "D1" || got[0].ConversationType != conversationIM {
+		t.Fatalf("unexpected message: %+v", got[0])
+	}
+}
+
+// Test for exporting system messages from archives as channel events
+func TestArchiveExporterChannelEvents(t *testing.T) {
+	path := writeTestArchive(t, map[string]string{
+		"users.json":    `[{"id":"U1","team_id":"T1","profile":{"display_name":"Alice"}},{"id":"U2","team_id":"T1"}]`,
+		"channels.json": `[{"id":"C1","name":"general"}]`,
+		"general/2024-01-16.json": `[
+			{"type":"message","subtype":"channel_topic","user":"U1","text":"set the channel topic: news","topic":"news","ts":"1705467634.000001"},
+			{"type":"message","subtype":"channel_name","user":"U1","text":"renamed the channel","name":"general","old_name":"main","ts":"1705467634.000002"},
+			{"type":"message","subtype":"channel_join","user":"U2","text":"<@U2> has joined the channel","inviter":"U1","ts":"1705467634.000003"},
+			{"type":"message","user":"U1","text":"hello","ts":"1705467634.000004"}
+		]`,
+	})
+	e := &ArchiveExporter{paths: []string{path}}
+	var got []transporter.Message
+	e.Export(context.Background(), func(m transporter.Message) {
+		got = append(got, m)
+	})
+	want := []transporter.Message{
+		{Type: eventChannelTopic, Text: "news", DisplayName: "Alice"},
+		{Type: eventChannelRename, Text: "general", DisplayName: "Alice"},
+		{Type: eventMemberJoined, Inviter: "U1"},
+		{Type: "message", Text: "hello", DisplayName: "Alice"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected number of messages; got %d; want %d", len(got), len(want))
+	}
+	for i, m := range got {
+		w := want[i]
+		if m.Type != w.Type || m.Text != w.Text || m.DisplayName != w.DisplayName || m.Inviter != w.Inviter {
+			t.Fatalf("unexpected message #%d; got %+v; want %+v", i, m, w)
+		}
+		if m.ChannelID != "C1" || m.ChannelName != "general" || m.TeamID != "T1" || m.ConversationType != conversationPublic {
+			t.Fatalf("unexpected channel of message #%d: %+v", i, m)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/slack-go/slack"
+
+	"slack2logs/flagutil"
+)
+
+var (
+	botsIncludeChannels = flagutil.NewArrayString("slack.bots.includeChannels", "Optional channel ids to export messages from bots, workflows and integrations from. "+
+		"Such messages are exported from all the channels if empty")
+	botsExcludeChannels = flagutil.NewArrayString("slack.bots.excludeChannels", "Optional channel ids to drop messages from bots, workflows and integrations in")
+)
+
+// isBotMessage reports whether msg is posted by bot, workflow or integration
+func isBotMessage(msg *slack.Msg) bool {
+	return msg.BotID != "" || msg.SubType == slack.MsgSubTypeBotMessage
+}
+
+// botMessagesAllowed reports whether messages from bots can be exported from channelID
+// according to -slack.bots.includeChannels and -slack.bots.excludeChannels
+func botMessagesAllowed(channelID string) bool {
+	if len(*botsIncludeChannels) > 0 && !slices.Contains(*botsIncludeChannels, channelID) {
+		return false
+	}
+	return !slices.Contains(*botsExcludeChannels, channelID)
+}
+
+// botFromProfile returns bot from bot_profile of the message.
+// It returns nil if the message has no bot_profile.
+func botFromProfile(msg *slack.Msg) *slack.Bot {
+	if msg.BotProfile == nil {
+		return nil
+	}
+	return &slack.Bot{
+		ID:    msg.BotProfile.ID,
+		Name:  msg.BotProfile.Name,
+		AppID: msg.BotProfile.AppID,
+	}
+}
+
+// botsCache caches bots obtained via bots.info,
+// since bots usually post a lot of messages
+type botsCache struct {
+	mu   sync.Mutex
+	bots map[string]*slack.Bot
+}
+
+// getBot returns bot for the message. bot_profile of the message is used if present,
+// otherwise the bot is obtained via bots.info.
+func (c *Client) getBot(ctx context.Context, msg *slack.Msg) (*slack.Bot, error) {
+	if bot := botFromProfile(msg); bot != nil {
+		return bot, nil
+	}
+	c.bots.mu.Lock()
+	bot, ok := c.bots.bots[msg.BotID]
+	c.bots.mu.Unlock()
+	if ok {
+		return bot, nil
+	}
+	bot, err := c.api.GetBotInfoContext(ctx, msg.BotID)
+	if err != nil {
+		return nil, fmt.Errorf("error get bot %q from message: %w", msg.BotID, err)
+	}
+	c.bots.mu.Lock()
+	if c.bots.bots == nil {
+		c.bots.bots = make(map[string]*slack.Bot)
+	}
+	c.bots.bots[msg.BotID] = bot
+	c.bots.mu.Unlock()
+	return bot, nil
+}
@@ -0,0 +1,366 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/slack-go/slack"
+
+	"slack2logs/transporter"
+)
+
+var (
+	catchupStateDir = flag.String("slack.catchup.stateDir", "", "Directory for persisting the newest shipped message ts per channel and recently active threads. "+
+		"It is used for catching up messages missed while slack2logs was stopped. The state is stored in <stateDir>/<team_id>.json. "+
+		"Messages missed during Socket Mode reconnects are caught up even if it is empty")
+	catchupMaxAge = flag.Duration("slack.catchup.maxAge", 24*time.Hour, "The maximum age of missed messages to catch up on startup and after reconnects. "+
+		"Older messages must be obtained via backfilling. Catching up is disabled if zero")
+	catchupMaxMessages = flag.Int("slack.catchup.maxMessages", 10000, "The maximum number of missed messages to catch up per channel on startup and after reconnects")
+)
+
+var (
+	catchupRuns          = metrics.GetOrCreateCounter(`vm_slack2logs_catchup_runs_total`)
+	catchupMessagesCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_received_total{source="slack_catchup"}`)
+	checkpointSaveErrors = metrics.GetOrCreateCounter(`vm_slack2logs_checkpoint_save_errors_total`)
+)
+
+// checkpoint tracks the newest shipped message ts per channel, recently active threads
+// and keys of recently shipped message revisions for deduplication of caught up messages
+type checkpoint struct {
+	// path is empty if the checkpoint isn't persisted
+	path string
+
+	mu     sync.Mutex
+	latest map[string]string
+	// threads contains the time of the newest shipped message per thread ts per channel.
+	// conversations.history returns only threads started after the checkpoint,
+	// so replies to older threads are caught up via these threads
+	threads map[string]map[string]time.Time
+	// shipped is keyed by channel id, message ts and edited ts, so edits are caught up as new revisions
+	shipped map[string]time.Time
+	dirty   bool
+}
+
+// checkpointState is the persisted part of checkpoint
+type checkpointState struct {
+	Latest  map[string]string               `json:"latest"`
+	Threads map[string]map[string]time.Time `json:"threads,omitempty"`
+}
+
+// newCheckpoint returns checkpoint loaded from path. It returns empty checkpoint if the file doesn't exist
+func newCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{
+		path:    path,
+		latest:  make(map[string]string),
+		threads: make(map[string]map[string]time.Time),
+		shipped: make(map[string]time.Time),
+	}
+	if path == "" {
+		return cp, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create directory for checkpoint %q: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cp, nil
+		}
+		return nil, fmt.Errorf("cannot read checkpoint %q: %w", path, err)
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse checkpoint %q: %w", path, err)
+	}
+	if state.Latest == nil {
+		// checkpoints written by older versions contain only the newest shipped ts per channel
+		if err := json.Unmarshal(data, &state.Latest); err != nil {
+			return nil, fmt.Errorf("cannot parse checkpoint %q: %w", path, err)
+		}
+	}
+	cp.latest = state.Latest
+	for channelID, threads := range state.Threads {
+		cp.threads[channelID] = threads
+	}
+	return cp, nil
+}
+
+// markShipped marks the message as passed to the outputs, so it isn't caught up again.
+// The checkpoint isn't advanced until the message is delivered, see add
+func (cp *checkpoint) markShipped(m *transporter.Message) {
+	if m.ChannelID == "" || m.MessageTS == "" {
+		return
+	}
+	t, err := parseTimestamp(m.MessageTS)
+	if err != nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.shipped[shippedKey(m.ChannelID, m.MessageTS, m.EditedTS)] = t
+	cp.mu.Unlock()
+}
+
+// add marks the message as shipped and advances the checkpoint.
+// It must be called only after the message is delivered, since catching up starts after the checkpoint
+func (cp *checkpoint) add(m *transporter.Message) {
+	if m.ChannelID == "" || m.MessageTS == "" {
+		return
+	}
+	t, err := parseTimestamp(m.MessageTS)
+	if err != nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.shipped[shippedKey(m.ChannelID, m.MessageTS, m.EditedTS)] = t
+	// only messages move the checkpoint, since channel events such as bookmark changes
+	// may be received while messages are missed
+	if m.Type != slack.TYPE_MESSAGE {
+		return
+	}
+	// standalone messages are roots of their own threads, so they are tracked only after getting replies
+	if m.ThreadTimeStamp != "" && (!m.IsThreadRoot || m.ReplyCount > 0) {
+		threads := cp.threads[m.ChannelID]
+		if threads == nil {
+			threads = make(map[string]time.Time)
+			cp.threads[m.ChannelID] = threads
+		}
+		if prev, ok := threads[m.ThreadTimeStamp]; !ok || prev.Before(t) {
+			threads[m.ThreadTimeStamp] = t
+			cp.dirty = true
+		}
+	}
+	if prev, ok := cp.latest[m.ChannelID]; ok {
+		if pt, err := parseTimestamp(prev); err == nil && !pt.Before(t) {
+			return
+		}
+	}
+	cp.latest[m.ChannelID] = m.MessageTS
+	cp.dirty = true
+}
+
+// isShipped reports whether the revision of the message with the given ts and edited ts from channelID was shipped
+func (cp *checkpoint) isShipped(channelID, ts, editedTS string) bool {
+	cp.mu.Lock()
+	_, ok := cp.shipped[shippedKey(channelID, ts, editedTS)]
+	cp.mu.Unlock()
+	return ok
+}
+
+func shippedKey(channelID, ts, editedTS string) string {
+	return channelID + "/" + ts + "/" + editedTS
+}
+
+// activeThreads returns ts of the threads from channelID with messages shipped within -slack.catchup.maxAge
+func (cp *checkpoint) activeThreads(channelID string) []string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	deadline := time.Now().Add(-*catchupMaxAge)
+	var threads []string
+	for threadTS, t := range cp.threads[channelID] {
+		if !t.Before(deadline) {
+			threads = append(threads, threadTS)
+		}
+	}
+	sort.Strings(threads)
+	return threads
+}
+
+// snapshot returns a copy of the newest shipped ts per channel
+func (cp *checkpoint) snapshot() map[string]string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	latest := make(map[string]string, len(cp.latest))
+	for channelID, ts := range cp.latest {
+		latest[channelID] = ts
+	}
+	return latest
+}
+
+// save persists the checkpoint if it was changed
+// and forgets shipped messages, which are too old for catching up
+func (cp *checkpoint) save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	deadline := time.Now().Add(-*catchupMaxAge)
+	for key, t := range cp.shipped {
+		if t.Before(deadline) {
+			delete(cp.shipped, key)
+		}
+	}
+	for channelID, threads := range cp.threads {
+		for threadTS, t := range threads {
+			if t.Before(deadline) {
+				delete(threads, threadTS)
+				cp.dirty = true
+			}
+		}
+		if len(threads) == 0 {
+			delete(cp.threads, channelID)
+		}
+	}
+	if cp.path == "" || !cp.dirty {
+		return nil
+	}
+	data, err := json.Marshal(checkpointState{Latest: cp.latest, Threads: cp.threads})
+	if err != nil {
+		return fmt.Errorf("cannot marshal checkpoint: %w", err)
+	}
+	// write to temporary file first, so the checkpoint isn't corrupted on crash
+	tmpPath := cp.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write checkpoint %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, cp.path); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, cp.path, err)
+	}
+	cp.dirty = false
+	return nil
+}
+
+// checkpointPath returns the path of checkpoint file for the workspace with the given team id
+func checkpointPath(teamID string) string {
+	if *catchupStateDir == "" {
+		return ""
+	}
+	return filepath.Join(*catchupStateDir, teamID+".json")
+}
+
+func (c *Client) saveCheckpoint() {
+	if err := c.checkpoint.save(); err != nil {
+		log.Printf("%serror save checkpoint: %s", c.logPrefix(), err)
+		checkpointSaveErrors.Inc()
+	}
+}
+
+// catchUp collects messages posted after the given ts per channel via conversations.history
+// and conversations.replies and adds them to the batch unless they were already shipped.
+// The number of messages and their age are limited by -slack.catchup.* flags.
+func (c *Client) catchUp(ctx context.Context, since map[string]string) {
+	if *catchupMaxAge <= 0 || len(since) == 0 {
+		return
+	}
+	c.catchupMu.Lock()
+	defer c.catchupMu.Unlock()
+	catchupRuns.Inc()
+
+	minTime := time.Now().Add(-*catchupMaxAge)
+	for channelID := range c.listeningChannels {
+		oldest, ok := since[channelID]
+		if !ok {
+			continue
+		}
+		t, err := parseTimestamp(oldest)
+		if err != nil {
+			log.Printf("%sinvalid checkpoint %q for channel %q: %s", c.logPrefix(), oldest, channelID, err)
+			continue
+		}
+		if t.Before(minTime) {
+			log.Printf("%scatching up channel %q since %s instead of %s according to -slack.catchup.maxAge", c.logPrefix(), channelID, minTime.Format(time.RFC3339), t.Format(time.RFC3339))
+			oldest = slackTimestamp(minTime)
+		}
+		n, err := c.catchUpChannel(ctx, channelID, oldest)
+		if err != nil {
+			log.Printf("%serror catch up channel %q: %s", c.logPrefix(), channelID, err)
+			handleMessageErrors.Inc()
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+		}
+		if n > 0 {
+			log.Printf("%scaught up %d missed messages in channel %q", c.logPrefix(), n, channelID)
+		}
+	}
+}
+
+// catchUpChannel collects messages and thread replies from channelID posted after oldest.
+// Replies are collected for threads returned by conversations.history and for threads active within -slack.catchup.maxAge.
+func (c *Client) catchUpChannel(ctx context.Context, channelID, oldest string) (int, error) {
+	n := 0
+	add := func(msg *slack.Msg) error {
+		if c.addCaughtUpMessage(ctx, channelID, msg) {
+			n++
+		}
+		return nil
+	}
+	checkLimit := func() error {
+		if n >= *catchupMaxMessages {
+			log.Printf("%sstop catching up channel %q after %d messages according to -slack.catchup.maxMessages", c.logPrefix(), channelID, n)
+			return errStopIteration
+		}
+		return nil
+	}
+	fetchedThreads := make(map[string]struct{})
+	err := c.forEachHistoryMessage(ctx, channelID, oldest, "", func(msg *slack.Msg) error {
+		_ = add(msg)
+		if msg.ReplyCount > 0 {
+			fetchedThreads[msg.Timestamp] = struct{}{}
+			if err := c.forEachReply(ctx, channelID, msg.Timestamp, oldest, add); err != nil {
+				return err
+			}
+		}
+		return checkLimit()
+	})
+	for _, threadTS := range c.checkpoint.activeThreads(channelID) {
+		if err != nil {
+			break
+		}
+		if _, ok := fetchedThreads[threadTS]; ok {
+			continue
+		}
+		if replyErr := c.forEachReply(ctx, channelID, threadTS, oldest, add); replyErr != nil {
+			if ctx.Err() != nil {
+				return n, replyErr
+			}
+			// the thread may be deleted, so other threads are still caught up
+			log.Printf("%serror catch up replies to thread %s in channel %q: %s", c.logPrefix(), threadTS, channelID, replyErr)
+			handleMessageErrors.Inc()
+			continue
+		}
+		err = checkLimit()
+	}
+	if errors.Is(err, errStopIteration) {
+		err = nil
+	}
+	return n, err
+}
+
+// addCaughtUpMessage adds msg to the batch if it wasn't shipped or received via events yet
+func (c *Client) addCaughtUpMessage(ctx context.Context, channelID string, msg *slack.Msg) bool {
+	catchupMessagesCount.Inc()
+	editedTS := ""
+	if msg.Edited != nil {
+		editedTS = msg.Edited.Timestamp
+	}
+	if c.checkpoint.isShipped(channelID, msg.Timestamp, editedTS) {
+		return false
+	}
+	m, ok, err := c.convertHistoryMessage(ctx, channelID, msg)
+	if err != nil {
+		log.Printf("%serror build message from channel %q: %s", c.logPrefix(), channelID, err)
+		handleMessageErrors.Inc()
+		return false
+	}
+	if !ok {
+		return false
+	}
+	key := batchKey(&m)
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	// messages received via events may be newer
+	if _, ok := c.batch[key]; ok {
+		return false
+	}
+	c.batch[key] = m
+	return true
+}
@@ -0,0 +1,195 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"slack2logs/transporter"
+)
+
+// Test for persisting checkpoint
+func TestCheckpoint(t *testing.T) {
+	origMaxAge := *catchupMaxAge
+	defer func() { *catchupMaxAge = origMaxAge }()
+	// the test messages are older than the default -slack.catchup.maxAge
+	*catchupMaxAge = 100 * 365 * 24 * time.Hour
+
+	path := filepath.Join(t.TempDir(), "T1.json")
+	cp, err := newCheckpoint(path)
+	if err != nil {
+		t.Fatalf("cannot create checkpoint: %s", err)
+	}
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399300.000100"})
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399200.000100"})
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399250.000100", EditedTS: "1705399260.000100", ThreadTimeStamp: "1705399100.000100"})
+	cp.add(&transporter.Message{Type: eventBookmarkRemoved, ChannelID: "C2", MessageTS: "1705399200.000100"})
+	if !cp.isShipped("C1", "1705399200.000100", "") || cp.isShipped("C1", "1705399400.000100", "") {
+		t.Fatalf("unexpected shipped messages: %v", cp.shipped)
+	}
+	// the previous revision of the edited message wasn't shipped
+	if !cp.isShipped("C1", "1705399250.000100", "1705399260.000100") || cp.isShipped("C1", "1705399250.000100", "") {
+		t.Fatalf("unexpected shipped revisions: %v", cp.shipped)
+	}
+	if err := cp.save(); err != nil {
+		t.Fatalf("cannot save checkpoint: %s", err)
+	}
+
+	cp, err = newCheckpoint(path)
+	if err != nil {
+		t.Fatalf("cannot load checkpoint: %s", err)
+	}
+	latest := cp.snapshot()
+	if len(latest) != 1 || latest["C1"] != "1705399300.000100" {
+		t.Fatalf("unexpected checkpoint: %v", latest)
+	}
+	if threads := cp.activeThreads("C1"); len(threads) != 1 || threads[0] != "1705399100.000100" {
+		t.Fatalf("unexpected active threads: %v", threads)
+	}
+}
+
+// Test for loading checkpoint written by older versions
+func TestCheckpointLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "T1.json")
+	if err := os.WriteFile(path, []byte(`{"C1":"1705399300.000100"}`), 0o600); err != nil {
+		t.Fatalf("cannot write checkpoint: %s", err)
+	}
+	cp, err := newCheckpoint(path)
+	if err != nil {
+		t.Fatalf("cannot load checkpoint: %s", err)
+	}
+	if latest := cp.snapshot(); len(latest) != 1 || latest["C1"] != "1705399300.000100" {
+		t.Fatalf("unexpected checkpoint: %v", latest)
+	}
+}
+
+// Test for Client.catchUp method
+func TestCatchUp(t *testing.T) {
+	mustInitPolicy()
+	origMaxAge := *catchupMaxAge
+	defer func() { *catchupMaxAge = origMaxAge }()
+	// the test messages are older than the default -slack.catchup.maxAge
+	*catchupMaxAge = 100 * 365 * 24 * time.Hour
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse request: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/conversations.history":
+			if oldest := r.Form.Get("oldest"); oldest != "1705399200.000100" {
+				t.Errorf("unexpected oldest=%q", oldest)
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"messages":[
+				{"type":"message","user":"U1","text":"missed","ts":"1705399300.000100"},
+				{"type":"message","user":"U1","text":"shipped","ts":"1705399250.000100"},
+				{"type":"message","user":"U1","text":"root","ts":"1705399210.000100","thread_ts":"1705399210.000100","reply_count":1}
+			]}`))
+		case "/conversations.replies":
+			switch ts := r.Form.Get("ts"); ts {
+			case "1705399210.000100":
+				_, _ = w.Write([]byte(`{"ok":true,"messages":[
+					{"type":"message","user":"U1","text":"root","ts":"1705399210.000100","thread_ts":"1705399210.000100","reply_count":1},
+					{"type":"message","user":"U1","text":"missed reply","ts":"1705399220.000100","thread_ts":"1705399210.000100"}
+				]}`))
+			case "1705399100.000100":
+				// the thread was started before the checkpoint, so it isn't returned by conversations.history
+				_, _ = w.Write([]byte(`{"ok":true,"messages":[
+					{"type":"message","user":"U1","text":"old root","ts":"1705399100.000100","thread_ts":"1705399100.000100","reply_count":3},
+					{"type":"message","user":"U1","text":"shipped old reply","ts":"1705399200.000100","thread_ts":"1705399100.000100"},
+					{"type":"message","user":"U1","text":"edited old reply","ts":"1705399240.000100","thread_ts":"1705399100.000100","edited":{"user":"U1","ts":"1705399290.000100"}},
+					{"type":"message","user":"U1","text":"missed old reply","ts":"1705399230.000100","thread_ts":"1705399100.000100"}
+				]}`))
+			default:
+				t.Errorf("unexpected replies request for thread %q", ts)
+			}
+		case "/users.info":
+			_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1","team_id":"T1","profile":{"display_name":"alice"}}}`))
+		case "/conversations.info":
+			_, _ = w.Write([]byte(`{"ok":true,"channel":{"id":"C1","name":"general"}}`))
+		default:
+			t.Errorf("unexpected request to %q", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	cp, err := newCheckpoint("")
+	if err != nil {
+		t.Fatalf("cannot create checkpoint: %s", err)
+	}
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399200.000100", ThreadTimeStamp: "1705399100.000100"})
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399240.000100", ThreadTimeStamp: "1705399100.000100"})
+	cp.add(&transporter.Message{Type: "message", ChannelID: "C1", MessageTS: "1705399250.000100", ThreadTimeStamp: "1705399250.000100", IsThreadRoot: true})
+	c := &Client{
+		api:               slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		listeningChannels: map[string]struct{}{"C1": {}},
+		workspace:         workspace{teamID: "T1"},
+		checkpoint:        cp,
+		batch: Messages{
+			// received via events before catching up
+			"1705399300.000100": {Type: "message", Text: "missed (edited)", ChannelID: "C1", MessageTS: "1705399300.000100"},
+		},
+	}
+	c.catchUp(context.Background(), map[string]string{"C1": "1705399200.000100"})
+
+	want := map[string]string{
+		"1705399300.000100": "missed (edited)",
+		"1705399210.000100": "root",
+		"1705399220.000100": "missed reply",
+		"1705399230.000100": "missed old reply",
+		"1705399240.000100": "edited old reply",
+	}
+	if len(c.batch) != len(want) {
+		t.Fatalf("unexpected number of messages in the batch; got %d; want %d", len(c.batch), len(want))
+	}
+	for key, text := range want {
+		if m := c.batch[key]; m.Text != text {
+			t.Fatalf("unexpected message %q in the batch; got %q; want %q", key, m.Text, text)
+		}
+	}
+}
+
+// Test for advancing checkpoint only after the flushed messages are delivered
+func TestClientDelivered(t *testing.T) {
+	cp, err := newCheckpoint("")
+	if err != nil {
+		t.Fatalf("cannot create checkpoint: %s", err)
+	}
+	m := transporter.Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100"}
+	c := &Client{
+		workspace:  workspace{teamID: "T1"},
+		checkpoint: cp,
+		batch:      Messages{m.MessageTS: m},
+	}
+	var flushed []transporter.Message
+	c.flush(func(m transporter.Message) {
+		flushed = append(flushed, m)
+	})
+	if len(flushed) != 1 {
+		t.Fatalf("unexpected number of flushed messages; got %d; want 1", len(flushed))
+	}
+	// the flushed message isn't caught up again, but the checkpoint isn't advanced until it is delivered
+	if !cp.isShipped("C1", m.MessageTS, "") {
+		t.Fatalf("expecting flushed message to be marked as shipped")
+	}
+	if latest := cp.snapshot(); len(latest) != 0 {
+		t.Fatalf("unexpected checkpoint before delivery: %v", latest)
+	}
+
+	// messages from other workspaces are ignored
+	other := m
+	other.TeamID = "T2"
+	other.MessageTS = "1705399300.000100"
+	c.Delivered(other)
+	c.Delivered(m)
+	if latest := cp.snapshot(); len(latest) != 1 || latest["C1"] != m.MessageTS {
+		t.Fatalf("unexpected checkpoint after delivery: %v", latest)
+	}
+}
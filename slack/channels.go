@@ -0,0 +1,393 @@
+package slack
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+var (
+	channelEvents          = flag.Bool("slack.channelEvents", true, "Whether to export channel metadata changes such as renames, archiving, topic and purpose changes, pins and bookmarks as separate entries")
+	bookmarksCheckInterval = flag.Duration("slack.bookmarks.checkInterval", 0, "Interval for checking bookmarks of the listened channels for changes if -slack.channelEvents is set. "+
+		"Slack doesn't send events for bookmark changes, so they are obtained via bookmarks.list, which requires bookmarks:read scope. Checking is disabled if zero")
+	membershipEvents = flag.Bool("slack.membershipEvents", true, "Whether to export members joining and leaving channels as separate entries")
+)
+
+// Types of channel metadata change entries
+const (
+	eventChannelRename    = "channel_rename"
+	eventChannelArchive   = "channel_archive"
+	eventChannelUnarchive = "channel_unarchive"
+	eventChannelTopic     = "channel_topic"
+	eventChannelPurpose   = "channel_purpose"
+	eventPinAdded         = "pin_added"
+	eventPinRemoved       = "pin_removed"
+	eventBookmarkAdded    = "bookmark_added"
+	eventBookmarkChanged  = "bookmark_changed"
+	eventBookmarkRemoved  = "bookmark_removed"
+	eventMemberJoined     = "member_joined_channel"
+	eventMemberLeft       = "member_left_channel"
+)
+
+// channelEvent represents a change of channel metadata
+type channelEvent struct {
+	typ       string
+	channelID string
+	// user is the author of the change. It may be empty
+	user string
+	// ts is the Slack timestamp of the change
+	ts string
+	// text contains the new value, for example the new channel name or topic
+	text string
+	// itemTS is the ts of the pinned message for pin events
+	itemTS string
+	// inviter is the user who invited the member for member_joined_channel events
+	inviter string
+	// userTeam is the team of the user if it is known
+	userTeam string
+}
+
+// enabled reports whether events of this type must be exported
+func (ev *channelEvent) enabled() bool {
+	switch ev.typ {
+	case eventMemberJoined, eventMemberLeft:
+		return *membershipEvents
+	default:
+		return *channelEvents
+	}
+}
+
+// channelEventFromMessage returns channel event for system messages about topic and purpose changes.
+// Slack has no dedicated events for them, so they are obtained from messages with the corresponding subtypes.
+func channelEventFromMessage(channelID string, msg *slack.Msg) (channelEvent, bool) {
+	ev := channelEvent{
+		channelID: channelID,
+		user:      msg.User,
+		ts:        msg.Timestamp,
+	}
+	switch msg.SubType {
+	case slack.MsgSubTypeChannelTopic, slack.MsgSubTypeGroupTopic:
+		ev.typ = eventChannelTopic
+		ev.text = msg.Topic
+	case slack.MsgSubTypeChannelPurpose, slack.MsgSubTypeGroupPurpose:
+		ev.typ = eventChannelPurpose
+		ev.text = msg.Purpose
+	default:
+		return channelEvent{}, false
+	}
+	return ev, true
+}
+
+// stateEventFromMessage returns channel event for system messages about renames, archiving and pins.
+// It is used during backfilling and catching up, since live changes are received via the dedicated events
+// such as channel_rename, channel_archive and pin_added.
+func stateEventFromMessage(channelID string, msg *slack.Msg) (channelEvent, bool) {
+	ev := channelEvent{
+		channelID: channelID,
+		user:      msg.User,
+		ts:        msg.Timestamp,
+	}
+	switch msg.SubType {
+	case slack.MsgSubTypeChannelName, slack.MsgSubTypeGroupName:
+		ev.typ = eventChannelRename
+		ev.text = msg.Name
+	case slack.MsgSubTypeChannelArchive, slack.MsgSubTypeGroupArchive:
+		ev.typ = eventChannelArchive
+	case slack.MsgSubTypeChannelUnarchive, slack.MsgSubTypeGroupUnarchive:
+		ev.typ = eventChannelUnarchive
+	case slack.MsgSubTypePinnedItem, slack.MsgSubTypeUnpinnedItem:
+		ev.typ = eventPinAdded
+		if msg.SubType == slack.MsgSubTypeUnpinnedItem {
+			ev.typ = eventPinRemoved
+		}
+		// the pinned message is attached to the system message
+		if len(msg.Attachments) > 0 {
+			ev.text = msg.Attachments[0].Text
+			ev.itemTS = string(msg.Attachments[0].Ts)
+		}
+	default:
+		return channelEvent{}, false
+	}
+	return ev, true
+}
+
+// memberEventFromMessage returns membership event for system messages about joining or leaving the channel.
+// It is used during backfilling, since live changes are received via member_joined_channel and member_left_channel events.
+func memberEventFromMessage(channelID string, msg *slack.Msg) (channelEvent, bool) {
+	ev := channelEvent{
+		channelID: channelID,
+		user:      msg.User,
+		ts:        msg.Timestamp,
+	}
+	switch msg.SubType {
+	case slack.MsgSubTypeChannelJoin, slack.MsgSubTypeGroupJoin:
+		ev.typ = eventMemberJoined
+		ev.inviter = msg.Inviter
+		ev.userTeam = msg.Team
+	case slack.MsgSubTypeChannelLeave, slack.MsgSubTypeGroupLeave:
+		ev.typ = eventMemberLeft
+	default:
+		return channelEvent{}, false
+	}
+	return ev, true
+}
+
+// systemEventFromMessage returns channel event for system messages about channel changes and membership.
+// It returns false if msg isn't such a system message or if the corresponding events aren't exported,
+// so msg must be exported as a regular message.
+func systemEventFromMessage(channelID string, msg *slack.Msg) (channelEvent, bool) {
+	ev, ok := channelEventFromMessage(channelID, msg)
+	if !ok {
+		ev, ok = stateEventFromMessage(channelID, msg)
+	}
+	if !ok {
+		ev, ok = memberEventFromMessage(channelID, msg)
+	}
+	if !ok || !ev.enabled() {
+		return channelEvent{}, false
+	}
+	return ev, true
+}
+
+// newPinEvent returns channel event for pinned or unpinned item
+func newPinEvent(typ, channelID, user, ts string, item slackevents.Item) channelEvent {
+	ev := channelEvent{
+		typ:       typ,
+		channelID: channelID,
+		user:      user,
+		ts:        ts,
+	}
+	if item.Message != nil {
+		ev.text = item.Message.Text
+		ev.itemTS = item.Message.Timestamp
+	}
+	return ev
+}
+
+// handleChannelEvent adds channel event to the batch of messages
+func (c *Client) handleChannelEvent(ctx context.Context, ev channelEvent) error {
+	if !ev.enabled() {
+		return nil
+	}
+	// legal hold applies only to the channels from the channel list of the workspace
+	if _, listening := c.listeningChannels[ev.channelID]; !listening {
+		return nil
+	}
+	if !globalPolicy.allow(ev.channelID, ev.user, false) {
+		return nil
+	}
+	m, err := c.buildChannelEvent(ctx, ev)
+	if err != nil {
+		return permanentIfNotFound(err)
+	}
+	c.addToBatch(m)
+	return nil
+}
+
+// buildChannelEvent resolves the author and the channel name of channel event
+// and converts it into transporter.Message
+func (c *Client) buildChannelEvent(ctx context.Context, ev channelEvent) (transporter.Message, error) {
+	var user *slack.User
+	if ev.user != "" {
+		u, err := c.getUser(ctx, ev.user, ev.userTeam, nil)
+		if err != nil {
+			return transporter.Message{}, fmt.Errorf("error get user %q from %s event: %w", ev.user, ev.typ, err)
+		}
+		user = u
+	}
+	info, err := c.channelInfo(ctx, ev.channelID)
+	if err != nil {
+		return transporter.Message{}, err
+	}
+	m, err := newChannelEventMessage(&c.workspace, info.name, user, ev)
+	if err != nil {
+		return transporter.Message{}, err
+	}
+	m.ConversationType = info.typ
+	return m, nil
+}
+
+// newChannelEventMessage converts channel event into transporter.Message.
+// The event type is stored in the type field.
+func newChannelEventMessage(ws *workspace, channelName string, user *slack.User, ev channelEvent) (transporter.Message, error) {
+	ts, err := parseTimestamp(ev.ts)
+	if err != nil {
+		return transporter.Message{}, &permanentError{fmt.Errorf("fail to parse timestamp:%q: %s", ev.ts, err)}
+	}
+	m := transporter.Message{
+		Type:        ev.typ,
+		User:        ev.user,
+		UserID:      ev.user,
+		Text:        ev.text,
+		TimeStamp:   ts.Format(time.RFC3339Nano),
+		MessageTS:   ev.ts,
+		Permalink:   permalink(ws.url, ev.channelID, ev.itemTS, ""),
+		ChannelID:   ev.channelID,
+		ChannelName: channelName,
+		TeamID:      ws.teamID,
+		TeamName:    ws.teamName,
+		Inviter:     ev.inviter,
+	}
+	if user != nil {
+		m.UserID = user.ID
+		m.DisplayName = user.Profile.DisplayName
+		m.DisplayNameNormalized = user.Profile.DisplayNameNormalized
+		m.UserTeam = user.TeamID
+		m.IsExternal = isExternal(user, ws.teamID)
+	}
+	return m, nil
+}
+
+// channelsCache caches channel names and types, so they aren't requested for every message.
+// Names are updated on channel_rename events.
+type channelsCache struct {
+	mu    sync.Mutex
+	infos map[string]channelInfo
+}
+
+// channelInfo contains channel details added to every message
+type channelInfo struct {
+	name string
+	// typ is the conversation type, see conversationType
+	typ string
+}
+
+// channelInfo returns the name and the type of the channel with the given id
+func (c *Client) channelInfo(ctx context.Context, channelID string) (channelInfo, error) {
+	c.channels.mu.Lock()
+	info, ok := c.channels.infos[channelID]
+	c.channels.mu.Unlock()
+	if ok {
+		return info, nil
+	}
+	ch, err := c.api.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
+		ChannelID: channelID,
+	})
+	if err != nil {
+		return channelInfo{}, fmt.Errorf("error get conversation info for channel %q: %w", channelID, err)
+	}
+	info = channelInfo{name: ch.Name, typ: conversationType(ch)}
+	c.setChannelInfo(channelID, info)
+	return info, nil
+}
+
+func (c *Client) setChannelInfo(channelID string, info channelInfo) {
+	c.channels.mu.Lock()
+	if c.channels.infos == nil {
+		c.channels.infos = make(map[string]channelInfo)
+	}
+	c.channels.infos[channelID] = info
+	c.channels.mu.Unlock()
+}
+
+// setChannelName updates the name of the cached channel.
+// Channels missing in the cache are requested with the actual name on the next message.
+func (c *Client) setChannelName(channelID, name string) {
+	c.channels.mu.Lock()
+	if info, ok := c.channels.infos[channelID]; ok {
+		info.name = name
+		c.channels.infos[channelID] = info
+	}
+	c.channels.mu.Unlock()
+}
+
+// watchBookmarks periodically checks bookmarks of the listened channels
+// and exports their changes. The first check only remembers the current bookmarks.
+func (c *Client) watchBookmarks(ctx context.Context) {
+	if !*channelEvents || *bookmarksCheckInterval <= 0 {
+		return
+	}
+	bookmarks := make(map[string]map[string]slack.Bookmark, len(c.listeningChannels))
+	ticker := time.NewTicker(*bookmarksCheckInterval)
+	defer ticker.Stop()
+	for {
+		for channelID := range c.listeningChannels {
+			list, err := c.api.ListBookmarksContext(ctx, channelID)
+			if err != nil {
+				log.Printf("%serror list bookmarks for channel %q: %s", c.logPrefix(), channelID, err)
+				handleMessageErrors.Inc()
+				continue
+			}
+			current := make(map[string]slack.Bookmark, len(list))
+			for _, b := range list {
+				current[b.ID] = b
+			}
+			if prev, ok := bookmarks[channelID]; ok {
+				for _, ev := range diffBookmarks(channelID, prev, current, time.Now()) {
+					if err := c.handleChannelEvent(ctx, ev); err != nil {
+						log.Printf("%serror handle %s event: %s", c.logPrefix(), ev.typ, err)
+						handleMessageErrors.Inc()
+					}
+				}
+			}
+			bookmarks[channelID] = current
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// diffBookmarks returns events for bookmarks added, changed or removed since prev.
+// Removal time is unknown, so now is used for it.
+func diffBookmarks(channelID string, prev, current map[string]slack.Bookmark, now time.Time) []channelEvent {
+	var events []channelEvent
+	for id, b := range current {
+		ev := channelEvent{
+			channelID: channelID,
+			user:      b.LastUpdatedByUserID,
+			text:      bookmarkText(b),
+		}
+		old, ok := prev[id]
+		switch {
+		case !ok:
+			ev.typ = eventBookmarkAdded
+			ev.ts = unixTimestamp(int64(b.Created), 0)
+		case old.Updated != b.Updated || old.Title != b.Title || old.Link != b.Link:
+			ev.typ = eventBookmarkChanged
+			ev.ts = unixTimestamp(int64(b.Updated), 0)
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	for id, b := range prev {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		events = append(events, channelEvent{
+			typ:       eventBookmarkRemoved,
+			channelID: channelID,
+			ts:        slackTimestamp(now),
+			text:      bookmarkText(b),
+		})
+	}
+	return events
+}
+
+func bookmarkText(b slack.Bookmark) string {
+	if b.Link == "" {
+		return b.Title
+	}
+	return b.Title + " " + b.Link
+}
+
+// unixTimestamp returns Slack timestamp for the given time
+func unixTimestamp(sec int64, usec int) string {
+	return fmt.Sprintf("%d.%06d", sec, usec)
+}
+
+// slackTimestamp returns Slack timestamp for t
+func slackTimestamp(t time.Time) string {
+	return unixTimestamp(t.Unix(), t.Nanosecond()/1000)
+}
@@ -0,0 +1,153 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+// Test for channel name refresh on channel_rename event
+func TestHandleChannelRename(t *testing.T) {
+	mustInitPolicy()
+	c := &Client{
+		listeningChannels: map[string]struct{}{"C1": {}},
+		workspace:         workspace{teamID: "T1", teamName: "Team"},
+		batch:             make(Messages),
+	}
+	c.setChannelInfo("C1", channelInfo{name: "old-name", typ: conversationPublic})
+
+	data := `{"type":"event_callback","team_id":"T1","event":{"type":"channel_rename","channel":{"id":"C1","name":"new-name","created":1705399200},"event_ts":"1705399200.000100"}}`
+	event, err := slackevents.ParseEvent(json.RawMessage(data), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		t.Fatalf("cannot parse event: %s", err)
+	}
+	if err := c.handleEventMessage(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	info, err := c.channelInfo(context.Background(), "C1")
+	if err != nil || info.name != "new-name" {
+		t.Fatalf("unexpected channel name %q after rename; error: %v", info.name, err)
+	}
+	want := transporter.Message{
+		Type:             eventChannelRename,
+		Text:             "new-name",
+		TimeStamp:        "2024-01-16T10:00:00.0001Z",
+		MessageTS:        "1705399200.000100",
+		ChannelID:        "C1",
+		ChannelName:      "new-name",
+		ConversationType: conversationPublic,
+		TeamID:           "T1",
+		TeamName:         "Team",
+	}
+	if got := c.batch[eventChannelRename+"/1705399200.000100"]; got != want {
+		t.Fatalf("unexpected channel_rename entry;\ngot\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+// Test for channelEventFromMessage function
+func TestChannelEventFromMessage(t *testing.T) {
+	msg := &slack.Msg{SubType: slack.MsgSubTypeChannelTopic, User: "U1", Timestamp: "1705399200.000100", Topic: "incidents only"}
+	ev, ok := channelEventFromMessage("C1", msg)
+	if !ok || ev.typ != eventChannelTopic || ev.text != "incidents only" || ev.user != "U1" {
+		t.Fatalf("unexpected channel event: %+v", ev)
+	}
+	if _, ok := channelEventFromMessage("C1", &slack.Msg{Text: "hello"}); ok {
+		t.Fatalf("regular message must not be converted into channel event")
+	}
+}
+
+// Test for stateEventFromMessage function
+func TestStateEventFromMessage(t *testing.T) {
+	f := func(msg *slack.Msg, wantType, wantText, wantItemTS string) {
+		t.Helper()
+		ev, ok := stateEventFromMessage("C1", msg)
+		if !ok {
+			t.Fatalf("expecting %s message to be converted into channel event", msg.SubType)
+		}
+		if ev.typ != wantType || ev.text != wantText || ev.itemTS != wantItemTS || ev.ts != msg.Timestamp || ev.user != msg.User {
+			t.Fatalf("unexpected channel event: %+v", ev)
+		}
+	}
+	f(&slack.Msg{SubType: slack.MsgSubTypeChannelName, User: "U1", Timestamp: "1705399200.000100", Name: "new-name", OldName: "old-name"}, eventChannelRename, "new-name", "")
+	f(&slack.Msg{SubType: slack.MsgSubTypeGroupArchive, User: "U1", Timestamp: "1705399200.000100"}, eventChannelArchive, "", "")
+	f(&slack.Msg{SubType: slack.MsgSubTypeChannelUnarchive, User: "U1", Timestamp: "1705399200.000100"}, eventChannelUnarchive, "", "")
+	f(&slack.Msg{SubType: slack.MsgSubTypePinnedItem, User: "U1", Timestamp: "1705399200.000100", Attachments: []slack.Attachment{{Text: "runbook", Ts: "1705399100.000200"}}},
+		eventPinAdded, "runbook", "1705399100.000200")
+	if _, ok := stateEventFromMessage("C1", &slack.Msg{SubType: slack.MsgSubTypeChannelTopic}); ok {
+		t.Fatalf("topic changes must be converted by channelEventFromMessage")
+	}
+}
+
+// Test for eventTimestamp function
+func TestEventTimestamp(t *testing.T) {
+	data := `{"type":"event_callback","team_id":"T1","event_time":1705399200,"event":{"type":"channel_rename","channel":{"id":"C1","name":"new-name","created":1705399200}}}`
+	event, err := slackevents.ParseEvent(json.RawMessage(data), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		t.Fatalf("cannot parse event: %s", err)
+	}
+	if ts := eventTimestamp(event, "1705399300.000100"); ts != "1705399300.000100" {
+		t.Fatalf("unexpected ts; got %q; want event_ts", ts)
+	}
+	if ts := eventTimestamp(event, ""); ts != "1705399200.000000" {
+		t.Fatalf("unexpected ts; got %q; want event_time", ts)
+	}
+}
+
+// Test for diffBookmarks function
+func TestDiffBookmarks(t *testing.T) {
+	prev := map[string]slack.Bookmark{
+		"Bk1": {ID: "Bk1", Title: "runbook", Link: "https://example.com/runbook", Created: 1705399200},
+		"Bk2": {ID: "Bk2", Title: "dashboard", Link: "https://example.com/d", Created: 1705399200},
+	}
+	current := map[string]slack.Bookmark{
+		"Bk1": {ID: "Bk1", Title: "runbook v2", Link: "https://example.com/runbook", Created: 1705399200, Updated: 1705399300, LastUpdatedByUserID: "U1"},
+		"Bk3": {ID: "Bk3", Title: "oncall", Link: "https://example.com/oncall", Created: 1705399400, LastUpdatedByUserID: "U2"},
+	}
+	now := time.Unix(1705399500, 123456000)
+	got := make(map[string]channelEvent)
+	for _, ev := range diffBookmarks("C1", prev, current, now) {
+		got[ev.typ] = ev
+	}
+	if len(got) != 3 {
+		t.Fatalf("unexpected number of events; got %d; want 3", len(got))
+	}
+	if ev := got[eventBookmarkChanged]; ev.text != "runbook v2 https://example.com/runbook" || ev.ts != "1705399300.000000" || ev.user != "U1" {
+		t.Fatalf("unexpected bookmark_changed event: %+v", ev)
+	}
+	if ev := got[eventBookmarkAdded]; ev.text != "oncall https://example.com/oncall" || ev.ts != "1705399400.000000" {
+		t.Fatalf("unexpected bookmark_added event: %+v", ev)
+	}
+	if ev := got[eventBookmarkRemoved]; ev.text != "dashboard https://example.com/d" || ev.ts != "1705399500.123456" {
+		t.Fatalf("unexpected bookmark_removed event: %+v", ev)
+	}
+}
+
+// Test for memberEventFromMessage function
+func TestMemberEventFromMessage(t *testing.T) {
+	msg := &slack.Msg{SubType: slack.MsgSubTypeChannelJoin, User: "U1", Inviter: "U2", Timestamp: "1705399200.000100"}
+	ev, ok := memberEventFromMessage("C1", msg)
+	if !ok || ev.typ != eventMemberJoined || ev.user != "U1" || ev.inviter != "U2" {
+		t.Fatalf("unexpected member event: %+v", ev)
+	}
+	m, err := newChannelEventMessage(&workspace{teamID: "T1"}, "general", nil, ev)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Type != eventMemberJoined || m.UserID != "U1" || m.Inviter != "U2" || m.TimeStamp != "2024-01-16T10:00:00.0001Z" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	ev, ok = memberEventFromMessage("G1", &slack.Msg{SubType: slack.MsgSubTypeGroupLeave, User: "U1", Timestamp: "1705399200.000100"})
+	if !ok || ev.typ != eventMemberLeft || ev.inviter != "" {
+		t.Fatalf("unexpected member event: %+v", ev)
+	}
+	if _, ok := memberEventFromMessage("C1", &slack.Msg{SubType: slack.MsgSubTypeChannelTopic}); ok {
+		t.Fatalf("topic change must not be converted into member event")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
@@ -25,14 +25,25 @@ import (
 
 const (
 	historicalRequestLimit = 500
-	joinedChannelMessage   = "> has joined the channel"
 	idLength               = 10
+
+	modeSocket = "socket"
+	modeHTTP   = "http"
 )
 
 var (
-	botToken           = flag.String("slack.auth.botToken", "", "Bot user OAuth token for Your Workspace")
-	appToken           = flag.String("slack.auth.appToken", "", "App-level tokens allow your app to use platform features that apply to multiple (or all) installations")
-	listeningChannels  = flagutil.NewArrayString("slack.channels", "Channels ids from slack to listen messages")
+	botToken  = flag.String("slack.auth.botToken", "", "Bot user OAuth token for Your Workspace")
+	userToken = flag.String("slack.auth.userToken", "", "Optional user OAuth token, which is used instead of -slack.auth.botToken. "+
+		"It allows reading private channels and direct messages the user is a member of. If -slack.channels is empty, "+
+		"the conversations are obtained via users.conversations according to -slack.conversationTypes")
+	appToken      = flag.String("slack.auth.appToken", "", "App-level tokens allow your app to use platform features that apply to multiple (or all) installations")
+	signingSecret = flag.String("slack.auth.signingSecret", "", "Signing secret of the Slack app. It is used for verifying Events API requests if -slack.mode=http")
+	mode          = flag.String("slack.mode", modeSocket, "Mode for receiving events from Slack. Supported values: socket, http. "+
+		"The socket mode uses Socket Mode and requires -slack.auth.appToken. "+
+		"The http mode serves Events API requests at "+EventsPath+" path of -http.listenAddr and requires -slack.auth.signingSecret")
+	listeningChannels = flagutil.NewArrayString("slack.channels", "Channels ids from slack to listen messages")
+	workspaceURL      = flag.String("slack.workspaceURL", "", "Optional workspace URL such as https://example.slack.com for building message permalinks. "+
+		"It is obtained via auth.test if empty. It must be set for building permalinks for messages imported from Slack export archives")
 	batchFlushInterval = flag.Duration("slack.batchFlushInterval", 900*time.Second, "Interval for flushing batch of messages to the additional service")
 )
 
@@ -44,11 +55,34 @@ var (
 
 // Client represents slack client
 type Client struct {
-	socketClient      *socketmode.Client
+	// name is the workspace name from -slack.workspacesConfig.
+	// It is empty if the workspace is configured via command-line flags.
+	name string
+	api  *slack.Client
+	// socketClient is nil if the client receives events via Events API over HTTP
+	socketClient *socketmode.Client
+	// eventsC contains acknowledged Socket Mode and Events API events, which wait for handling
+	eventsC chan slackevents.EventsAPIEvent
+	// retryC contains events, which failed with temporary errors and wait for retrying.
+	// pendingRetries is the number of events scheduled for retrying including events in retryC
+	retryC         chan queuedEvent
+	pendingRetries atomic.Int64
+	// seenEvents contains recently received event ids
+	seenEvents        *lruSet
+	signingSecret     string
 	messageC          chan transporter.Message
 	threadC           chan ThreadRequest
 	listeningChannels map[string]struct{}
 
+	// workspace is obtained via auth.test on client creation
+	workspace
+	bots     botsCache
+	channels channelsCache
+
+	// checkpoint is used for catching up messages missed during restarts and reconnects
+	checkpoint *checkpoint
+	catchupMu  sync.Mutex
+
 	mx    sync.Mutex
 	batch Messages
 }
@@ -62,34 +96,101 @@ type ThreadRequest struct {
 
 type Messages map[string]transporter.Message
 
-func New() *Client {
-	if len(*listeningChannels) == 0 {
-		log.Fatalf("got %d slack channels to listen to. At least one slack channel should be defined", len(*listeningChannels))
+// NewClients returns clients for all the configured Slack workspaces.
+//
+// Workspaces are read from -slack.workspacesConfig if it is set.
+// Otherwise, a single workspace is configured via -slack.auth.* and -slack.channels flags.
+func NewClients() []*Client {
+	if *workspacesConfig == "" {
+		return []*Client{New(&WorkspaceConfig{
+			BotToken:      *botToken,
+			UserToken:     *userToken,
+			AppToken:      *appToken,
+			SigningSecret: *signingSecret,
+			Channels:      *listeningChannels,
+			URL:           *workspaceURL,
+		})}
 	}
-	client := slack.New(*botToken, slack.OptionAppLevelToken(*appToken))
-	// go-slack comes with a SocketMode package that we need to use that
-	// accepts a Slack client and outputs a Socket mode client instead
-	socketClient := socketmode.New(
-		client,
-		// Option to set a custom logger
-		socketmode.OptionLog(log.New(os.Stdout, "socketmode: ", log.Lshortfile|log.LstdFlags)),
-	)
+	if *botToken != "" || *userToken != "" || *appToken != "" || *signingSecret != "" || len(*listeningChannels) > 0 || *workspaceURL != "" {
+		log.Fatalf("-slack.workspacesConfig cannot be used together with -slack.auth.*, -slack.channels and -slack.workspaceURL flags")
+	}
+	cfg, err := loadConfig(*workspacesConfig)
+	if err != nil {
+		log.Fatalf("cannot load -slack.workspacesConfig=%q: %s", *workspacesConfig, err)
+	}
+	clients := make([]*Client, 0, len(cfg.Workspaces))
+	for i := range cfg.Workspaces {
+		clients = append(clients, New(&cfg.Workspaces[i]))
+	}
+	return clients
+}
+
+// New returns client for the given workspace
+func New(ws *WorkspaceConfig) *Client {
+	if len(ws.Channels) == 0 && ws.UserToken == "" {
+		log.Fatalf("got %d slack channels to listen to. At least one slack channel should be defined", len(ws.Channels))
+	}
+	if ws.BotToken != "" && ws.UserToken != "" {
+		log.Fatalf("bot token and user token cannot be set simultaneously for workspace %q", ws.Name)
+	}
+	token := ws.BotToken
+	if ws.UserToken != "" {
+		token = ws.UserToken
+	}
+	client := slack.New(token, slack.OptionAppLevelToken(ws.AppToken))
 
 	c := Client{
-		socketClient:      socketClient,
+		name:              ws.Name,
+		api:               client,
 		messageC:          make(chan transporter.Message, 1),
 		threadC:           make(chan ThreadRequest, 1),
-		listeningChannels: make(map[string]struct{}, len(*listeningChannels)),
+		listeningChannels: make(map[string]struct{}, len(ws.Channels)),
+		workspace:         workspace{url: ws.URL},
 		batch:             make(Messages),
+		eventsC:           make(chan slackevents.EventsAPIEvent, *eventsQueueSize),
+		retryC:            make(chan queuedEvent, *eventsQueueSize),
+		seenEvents:        newLRUSet(*eventsDedupCacheSize),
 	}
-	for _, ch := range *listeningChannels {
+	for _, ch := range ws.Channels {
 		c.listeningChannels[ch] = struct{}{}
 	}
+	switch *mode {
+	case modeSocket:
+		// go-slack comes with a SocketMode package that we need to use that
+		// accepts a Slack client and outputs a Socket mode client instead
+		c.socketClient = socketmode.New(
+			client,
+			// Option to set a custom logger
+			socketmode.OptionLog(log.New(os.Stdout, c.logPrefix()+"socketmode: ", log.Lshortfile|log.LstdFlags)),
+		)
+	case modeHTTP:
+		if ws.SigningSecret == "" {
+			log.Fatalf("signing secret must be set for workspace %q if -slack.mode=%s", ws.Name, modeHTTP)
+		}
+		c.signingSecret = ws.SigningSecret
+	default:
+		log.Fatalf("unsupported -slack.mode=%q; supported values: %s, %s", *mode, modeSocket, modeHTTP)
+	}
+	if err := c.init(context.Background()); err != nil {
+		log.Fatalf("%scannot initialize slack client: %s", c.logPrefix(), err)
+	}
+	mustInitPolicy()
 	return &c
 }
 
-// Run starts slack websocket client and event listener
+// Run starts slack websocket client and event listener.
+// In the http mode events are received via EventsHandler,
+// so Run only handles queued events until ctx is done.
 func (c *Client) Run(ctx context.Context) error {
+	go c.watchBookmarks(ctx)
+	go c.processEvents(ctx)
+	if c.socketClient == nil {
+		// socket mode catches up on connection
+		go c.catchUp(ctx, c.checkpoint.snapshot())
+		<-ctx.Done()
+		close(c.messageC)
+		return ctx.Err()
+	}
 	go c.handleEvents(ctx)
 	return c.socketClient.RunContext(ctx)
 }
@@ -98,7 +199,10 @@ func (c *Client) Run(ctx context.Context) error {
 // historical messages and threads
 func (c *Client) RunHistoricalBackfilling(ctx context.Context) error {
 	go c.collectHistoricalMessages(ctx)
-	go c.collectThreadMessages(ctx)
+	if c.socketClient == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
 	err := c.socketClient.RunContext(ctx)
 	if err != nil {
 		return fmt.Errorf("error run slack socket client: %w", err)
@@ -106,6 +210,35 @@ func (c *Client) RunHistoricalBackfilling(ctx context.Context) error {
 	return nil
 }
 
+// init obtains information about the workspace the client is connected to
+func (c *Client) init(ctx context.Context) error {
+	resp, err := c.api.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error get workspace info via auth.test: %w", err)
+	}
+	c.teamID = resp.TeamID
+	c.teamName = resp.Team
+	if c.url == "" {
+		c.url = resp.URL
+	}
+	c.checkpoint, err = newCheckpoint(checkpointPath(c.teamID))
+	if err != nil {
+		return err
+	}
+	log.Printf("%sconnected to the workspace %q (%s)", c.logPrefix(), c.teamName, c.teamID)
+	if len(c.listeningChannels) == 0 {
+		return c.discoverConversations(ctx)
+	}
+	return c.dropDisallowedDMs(ctx)
+}
+
+func (c *Client) logPrefix() string {
+	if c.name == "" {
+		return ""
+	}
+	return c.name + ": "
+}
+
 // Export sends slack message to the additional service via callback
 func (c *Client) Export(ctx context.Context, cb func(m transporter.Message)) {
 	ticker := time.NewTicker(*batchFlushInterval)
@@ -114,9 +247,11 @@ func (c *Client) Export(ctx context.Context, cb func(m transporter.Message)) {
 		select {
 		case <-ctx.Done():
 			c.flush(cb)
+			c.saveCheckpoint()
 			return
 		case <-ticker.C:
 			c.flush(cb)
+			c.saveCheckpoint()
 		case m, ok := <-c.messageC:
 			if !ok {
 				return
@@ -134,6 +269,8 @@ func (c *Client) flush(cb func(m transporter.Message)) {
 	log.Printf("sending batch of %d messages", len(c.batch))
 	c.mx.Lock()
 	for _, m := range c.batch {
+		// the checkpoint is advanced in Delivered after the outputs deliver the message
+		c.checkpoint.markShipped(&m)
 		cb(m)
 	}
 	messageOutCount.Add(len(c.batch))
@@ -142,6 +279,25 @@ func (c *Client) flush(cb func(m transporter.Message)) {
 	log.Printf("batch flushed successfuly")
 }
 
+// Delivered advances the checkpoint after the message is delivered by all the outputs.
+// It implements transporter.DeliveryListener.
+func (c *Client) Delivered(m transporter.Message) {
+	// messages from other workspaces are delivered to all the clients
+	if c.checkpoint == nil || m.TeamID != c.teamID {
+		return
+	}
+	c.checkpoint.add(&m)
+}
+
+// Close persists the checkpoint with messages delivered after the export is finished,
+// for example, messages sent by outputs on close
+func (c *Client) Close() error {
+	if c.checkpoint == nil {
+		return nil
+	}
+	return c.checkpoint.save()
+}
+
 func (c *Client) handleEvents(ctx context.Context) {
 	for {
 		select {
@@ -153,6 +309,9 @@ func (c *Client) handleEvents(ctx context.Context) {
 			// We have a new Events, let's type switch the event
 			// Add more use cases here if you want to listen to other events.
 			switch event.Type {
+			case socketmode.EventTypeConnected:
+				// messages posted while the client was disconnected or stopped aren't delivered via events
+				go c.catchUp(ctx, c.checkpoint.snapshot())
 			// handle EventAPI events
 			case socketmode.EventTypeEventsAPI:
 				// The Event sent on the channel is not the same as the EventAPI events so we need to type cast it
@@ -162,12 +321,10 @@ func (c *Client) handleEvents(ctx context.Context) {
 					handleMessageErrors.Inc()
 					continue
 				}
-				if err := c.handleEventMessage(ctx, eventsAPIEvent); err != nil {
-					log.Printf("error handle event message: %s", err)
-					handleMessageErrors.Inc()
+				// the event is acknowledged once it is queued, handling errors are retried internally
+				if !c.enqueueEvent(ctx, eventsAPIEvent) {
 					continue
 				}
-				// We need to send an Acknowledge to the slack server
 				err := c.socketClient.AckCtx(ctx, event.Request.EnvelopeID, *event.Request)
 				if err != nil {
 					log.Printf("error ack to the channel: %s", err)
@@ -190,224 +347,243 @@ func (c *Client) handleEventMessage(ctx context.Context, event slackevents.Event
 		switch ev := innerEvent.Data.(type) {
 		case *slackevents.MessageEvent:
 			messagesReceivedCount.Inc()
-			if _, ok := c.listeningChannels[ev.Channel]; !ok {
-				return fmt.Errorf("got message from unsupported channel id: %s", ev.Channel)
+			msg, err := parseMessageEvent(event)
+			if err != nil {
+				return &permanentError{err}
+			}
+			if cev, ok := channelEventFromMessage(ev.Channel, &msg.Msg); ok && *channelEvents {
+				return c.handleChannelEvent(ctx, cev)
 			}
-			// skip messages like join channel
-			if filterOutLogMessage(ev.Text) {
+			if !dmAllowed(ev.Channel, conversationTypeFromEvent(ev.ChannelType)) {
 				return nil
 			}
-			if ev.SubType == slack.MsgSubTypeMessageChanged {
-				ev.User = ev.Message.User
-				ev.Text = ev.Message.Text
-				if ev.Message.ThreadTimeStamp != ev.Message.TimeStamp {
-					// this is thread message
-					ev.ThreadTimeStamp = ev.Message.ThreadTimeStamp
-				}
+			// legal hold doesn't apply to channels outside the channel list of the workspace,
+			// since the app may receive messages from channels of other workspaces
+			if _, listening := c.listeningChannels[ev.Channel]; !listening {
+				return &permanentError{fmt.Errorf("got message from unsupported channel id: %s", ev.Channel)}
 			}
-
-			threadTS := ev.ThreadTimeStamp
-			if ev.ThreadTimeStamp == "" {
-				threadTS = ev.TimeStamp
+			if !globalPolicy.allow(ev.Channel, msg.User, isFiltered(ev.Channel, &msg.Msg)) {
+				return nil
 			}
-			user, err := c.socketClient.GetUserInfoContext(ctx, ev.User)
+
+			m, err := c.buildMessage(ctx, ev.Channel, msg)
 			if err != nil {
-				return fmt.Errorf("error get user from message: %w", err)
+				return permanentIfNotFound(err)
 			}
-			ch, err := c.socketClient.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
-				ChannelID: ev.Channel,
+			c.addToBatch(m)
+		case *slackevents.ChannelRenameEvent:
+			c.setChannelName(ev.Channel.ID, ev.Channel.Name)
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelRename,
+				channelID: ev.Channel.ID,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+				text:      ev.Channel.Name,
 			})
-			if err != nil {
-				return fmt.Errorf("error get conversation info: %s", err)
-			}
-			ts, err := strconv.ParseFloat(ev.TimeStamp, 64)
-			if err != nil {
-				return fmt.Errorf("fail to parse timestamp:%q: %s", ev.TimeStamp, err)
-			}
-
-			id := generateMessageID(threadTS)
-
-			m := transporter.Message{
-				ThreadID:              id,
-				Type:                  ev.Type,
-				User:                  ev.User,
-				Text:                  ev.Text,
-				ThreadTimeStamp:       threadTS,
-				TimeStamp:             time.Unix(int64(ts), 0).Format(time.RFC3339),
-				ChannelID:             ev.Channel,
-				ChannelName:           ch.Name,
-				UserID:                user.ID,
-				DisplayName:           user.Profile.DisplayName,
-				DisplayNameNormalized: user.Profile.DisplayNameNormalized,
-			}
-
-			if ev.SubType == slack.MsgSubTypeMessageChanged {
-				if ev.PreviousMessage.ThreadTimeStamp != "" {
-					m.ThreadTimeStamp = ev.PreviousMessage.ThreadTimeStamp
-				} else {
-					m.ThreadTimeStamp = ev.PreviousMessage.TimeStamp
-				}
-			}
-
-			timestamp := getBatchTimestamp(ev)
-			c.mx.Lock()
-			c.batch[timestamp] = m
-			c.mx.Unlock()
+		case *slackevents.GroupRenameEvent:
+			c.setChannelName(ev.Channel.ID, ev.Channel.Name)
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelRename,
+				channelID: ev.Channel.ID,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+				text:      ev.Channel.Name,
+			})
+		case *slackevents.ChannelArchiveEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelArchive,
+				channelID: ev.Channel,
+				user:      ev.User,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+			})
+		case *slackevents.ChannelUnarchiveEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelUnarchive,
+				channelID: ev.Channel,
+				user:      ev.User,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+			})
+		case *slackevents.GroupArchiveEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelArchive,
+				channelID: ev.Channel,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+			})
+		case *slackevents.GroupUnarchiveEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventChannelUnarchive,
+				channelID: ev.Channel,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+			})
+		case *slackevents.MemberJoinedChannelEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventMemberJoined,
+				channelID: ev.Channel,
+				user:      ev.User,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+				inviter:   ev.Inviter,
+				userTeam:  ev.Team,
+			})
+		case *slackevents.MemberLeftChannelEvent:
+			return c.handleChannelEvent(ctx, channelEvent{
+				typ:       eventMemberLeft,
+				channelID: ev.Channel,
+				user:      ev.User,
+				ts:        eventTimestamp(event, ev.EventTimestamp),
+				userTeam:  ev.Team,
+			})
+		case *slackevents.PinAddedEvent:
+			return c.handleChannelEvent(ctx, newPinEvent(eventPinAdded, ev.Channel, ev.User, eventTimestamp(event, ev.EventTimestamp), ev.Item))
+		case *slackevents.PinRemovedEvent:
+			return c.handleChannelEvent(ctx, newPinEvent(eventPinRemoved, ev.Channel, ev.User, eventTimestamp(event, ev.EventTimestamp), ev.Item))
 		default:
-			return errors.New("got unsupported inner event type")
+			return &permanentError{fmt.Errorf("got unsupported inner event type %q", innerEvent.Type)}
 		}
 	default:
-		return errors.New("unsupported event type")
+		return &permanentError{fmt.Errorf("unsupported event type %q", event.Type)}
 	}
 	return nil
 }
 
+// addToBatch adds m to the batch. Edits of the message replace it in the batch
+// unless the batch already contains a newer revision received before the retry of the failed event.
+func (c *Client) addToBatch(m transporter.Message) {
+	key := batchKey(&m)
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if prev, ok := c.batch[key]; ok && isNewerRevision(prev.EditedTS, m.EditedTS) {
+		return
+	}
+	c.batch[key] = m
+}
+
+// isNewerRevision reports whether the message edited at editedTS is newer than the message edited at otherTS.
+// Empty values mean the original message.
+func isNewerRevision(editedTS, otherTS string) bool {
+	if editedTS == "" {
+		return false
+	}
+	if otherTS == "" {
+		return true
+	}
+	t, err := parseTimestamp(editedTS)
+	if err != nil {
+		return false
+	}
+	other, err := parseTimestamp(otherTS)
+	if err != nil {
+		return true
+	}
+	return t.After(other)
+}
+
+// eventTimestamp returns ts if it is set. Otherwise, event_time of the event envelope is returned,
+// since some events such as channel_rename and member_joined_channel may have no event_ts.
+func eventTimestamp(event slackevents.EventsAPIEvent, ts string) string {
+	if ts != "" {
+		return ts
+	}
+	if cb, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && cb.EventTime > 0 {
+		return unixTimestamp(int64(cb.EventTime), 0)
+	}
+	return slackTimestamp(time.Now())
+}
+
+// collectHistoricalMessages collects messages from all the listened channels via conversations.history
+// and replies to their threads via conversations.replies. messageC is closed when all the messages are collected.
 func (c *Client) collectHistoricalMessages(ctx context.Context) {
+	threadsDone := make(chan struct{})
+	go func() {
+		defer close(threadsDone)
+		c.collectThreadMessages(ctx)
+	}()
+
 	var wg sync.WaitGroup
 	for ch := range c.listeningChannels {
 		wg.Add(1)
 		go func(channelID string) {
 			defer wg.Done()
-			for {
-				var cursor string
-				params := &slack.GetConversationHistoryParameters{
-					ChannelID:          channelID,
-					Cursor:             cursor,
-					Inclusive:          true,
-					Limit:              historicalRequestLimit,
-					IncludeAllMetadata: false,
-				}
-
-				historyContext, err := c.socketClient.GetConversationHistoryContext(ctx, params)
-				if err != nil {
-					log.Printf("error get historical conversation for channel id %s, with error: %s", channelID, err)
-					break
-				}
-				if len(historyContext.Error) != 0 {
-					log.Printf("error with history context: %s", err)
-					break
-				}
-				for _, m := range historyContext.Messages {
-					user, err := c.socketClient.GetUserInfoContext(ctx, m.User)
-					if err != nil {
-						log.Printf("error get user %q from message: %s", m.User, err)
-						if errors.Is(err, context.Canceled) {
-							return
-						}
-						continue
-					}
-					ch, err := c.socketClient.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
-						ChannelID: channelID,
-					})
-					if err != nil {
-						log.Printf("error get conversation info: %s", err)
-						if errors.Is(err, context.Canceled) {
-							return
-						}
-						continue
-					}
-					ts, err := strconv.ParseFloat(m.Timestamp, 64)
-					if err != nil {
-						log.Printf("fail to parse timestamp:%q: %s", m.Timestamp, err)
-						continue
+			err := c.forEachHistoryMessage(ctx, channelID, "", "", func(m *slack.Msg) error {
+				if m.ReplyCount > 0 {
+					select {
+					case c.threadC <- ThreadRequest{ChannelID: channelID, Timestamp: m.Timestamp}:
+					case <-ctx.Done():
+						return ctx.Err()
 					}
-					c.threadC <- ThreadRequest{
-						ChannelID: channelID,
-						Timestamp: m.Timestamp,
-					}
-
-					if m.ThreadTimestamp == "" {
-						m.ThreadTimestamp = m.Timestamp
-					}
-					c.messageC <- transporter.Message{
-						Type:                  m.Type,
-						User:                  m.User,
-						Text:                  m.Text,
-						ThreadTimeStamp:       m.ThreadTimestamp,
-						TimeStamp:             time.Unix(int64(ts), 0).Format(time.RFC3339),
-						ChannelID:             channelID,
-						ChannelName:           ch.Name,
-						UserID:                user.ID,
-						DisplayName:           user.Profile.DisplayName,
-						DisplayNameNormalized: user.Profile.DisplayNameNormalized,
-					}
-				}
-				cursor = historyContext.ResponseMetaData.NextCursor
-				if !historyContext.HasMore {
-					break
 				}
+				return c.sendHistoryMessage(ctx, channelID, m)
+			})
+			if err != nil {
+				log.Printf("error get historical conversation for channel id %s, with error: %s", channelID, err)
 			}
 		}(ch)
 	}
 	wg.Wait()
-	close(c.messageC)
 	close(c.threadC)
+	<-threadsDone
+	close(c.messageC)
 }
 
-func (c *Client) collectThreadMessages(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case threadInfo := <-c.threadC:
-			var repliesCursor string
-			repliesMessages, hasMore, nextCursor, err := c.socketClient.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
-				ChannelID:          threadInfo.ChannelID,
-				Timestamp:          threadInfo.Timestamp,
-				Cursor:             repliesCursor,
-				Inclusive:          true,
-				Limit:              historicalRequestLimit,
-				IncludeAllMetadata: false,
-			})
-			if err != nil {
-				log.Printf("error get replies for timestamp: %q", threadInfo.Timestamp)
-				continue
-			}
-			for _, rp := range repliesMessages {
-				user, err := c.socketClient.GetUserInfoContext(ctx, rp.User)
-				if err != nil {
-					log.Printf("error get user %q from message: %s", rp.User, err)
-					continue
-				}
-				ch, err := c.socketClient.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
-					ChannelID: threadInfo.ChannelID,
-				})
-				if err != nil {
-					log.Printf("error get conversation info for channel %q with timestamp %s: %s", threadInfo.ChannelID, threadInfo.Timestamp, err)
-					continue
-				}
-				ts, err := strconv.ParseFloat(rp.Timestamp, 64)
-				if err != nil {
-					log.Printf("fail to parse timestamp:%q: %s", rp.Timestamp, err)
-					continue
-				}
-				c.messageC <- transporter.Message{
-					Type:                  rp.Type,
-					User:                  rp.User,
-					Text:                  rp.Text,
-					ThreadTimeStamp:       rp.ThreadTimestamp,
-					TimeStamp:             time.Unix(int64(ts), 0).Format(time.RFC3339),
-					ChannelID:             threadInfo.ChannelID,
-					ChannelName:           ch.Name,
-					UserID:                user.ID,
-					DisplayName:           user.Profile.DisplayName,
-					DisplayNameNormalized: user.Profile.DisplayNameNormalized,
-				}
-			}
-			repliesCursor = nextCursor
-			if !hasMore {
-				break
-			}
+// sendHistoryMessage converts msg obtained via conversations.history or conversations.replies and sends it to messageC.
+// Conversion errors are logged, so only ctx errors are returned.
+func (c *Client) sendHistoryMessage(ctx context.Context, channelID string, msg *slack.Msg) error {
+	m, ok, err := c.convertHistoryMessage(ctx, channelID, msg)
+	if err != nil {
+		log.Printf("error build message from channel %q: %s", channelID, err)
+		return ctx.Err()
+	}
+	if !ok {
+		return nil
+	}
+	select {
+	case c.messageC <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// convertHistoryMessage converts msg obtained via conversations.history or conversations.replies.
+// System messages about channel changes are converted into channel events.
+// It returns false if the message must be dropped according to filters and policies.
+func (c *Client) convertHistoryMessage(ctx context.Context, channelID string, msg *slack.Msg) (transporter.Message, bool, error) {
+	if cev, ok := systemEventFromMessage(channelID, msg); ok {
+		if !globalPolicy.allow(channelID, msg.User, false) {
+			return transporter.Message{}, false, nil
+		}
+		m, err := c.buildChannelEvent(ctx, cev)
+		if err != nil {
+			return transporter.Message{}, false, fmt.Errorf("error build %s event: %w", cev.typ, err)
 		}
+		return m, true, nil
+	}
+	if !globalPolicy.allow(channelID, msg.User, isFiltered(channelID, msg)) {
+		return transporter.Message{}, false, nil
+	}
+	m, err := c.buildMessage(ctx, channelID, &userMessage{Msg: *msg})
+	if err != nil {
+		return transporter.Message{}, false, err
+	}
+	return m, true, nil
+}
+
+// batchKey returns the key of m in the batch, so edits of the message
+// and the same message received from different sources replace each other
+func batchKey(m *transporter.Message) string {
+	if m.Type == "" || m.Type == slack.TYPE_MESSAGE {
+		return m.MessageTS
 	}
+	return m.Type + "/" + m.MessageTS
 }
 
-func getBatchTimestamp(ev *slackevents.MessageEvent) string {
-	timestamp := ev.TimeStamp
-	if ev.SubType == slack.MsgSubTypeMessageChanged {
-		timestamp = ev.PreviousMessage.TimeStamp
+// collectThreadMessages collects replies to threads received via threadC until it is closed
+func (c *Client) collectThreadMessages(ctx context.Context) {
+	for threadInfo := range c.threadC {
+		err := c.forEachReply(ctx, threadInfo.ChannelID, threadInfo.Timestamp, "", func(m *slack.Msg) error {
+			return c.sendHistoryMessage(ctx, threadInfo.ChannelID, m)
+		})
+		if err != nil {
+			log.Printf("error get replies for timestamp %q: %s", threadInfo.Timestamp, err)
+		}
 	}
-	return timestamp
 }
 
 func generateMessageID(threadTs string) string {
@@ -419,7 +595,27 @@ func generateMessageID(threadTs string) string {
 	return id
 }
 
-func filterOutLogMessage(msg string) bool {
-	// filter out "user joined Slack channel messages", msg example "<@U0787V2AW9W> has joined the channel"
-	return strings.HasSuffix(msg, joinedChannelMessage)
+// parseTimestamp parses Slack message ts in the form "1705399200.000100"
+// without losing precision of the fractional part
+func parseTimestamp(ts string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(frac) > 9 {
+		return time.Time{}, fmt.Errorf("too many digits in fractional part %q", frac)
+	}
+	var nsec int64
+	for i := 0; i < 9; i++ {
+		nsec *= 10
+		if i >= len(frac) {
+			continue
+		}
+		if frac[i] < '0' || frac[i] > '9' {
+			return time.Time{}, fmt.Errorf("invalid fractional part %q", frac)
+		}
+		nsec += int64(frac[i] - '0')
+	}
+	return time.Unix(sec, nsec).UTC(), nil
 }
@@ -1,20 +1,186 @@
 package slack
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
 
-// Test for filterOutLogMessage function
-func TestFilterOutLogMessage(t *testing.T) {
-	tests := []struct {
-		message string
-		want    bool
-	}{
-		{"<@U0787V2AW9W> has joined the channel", true},
-		{"User message content", false},
-		{"Another message", false},
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+// Test for subtypeAllowed function
+func TestSubtypeAllowed(t *testing.T) {
+	f := func(include, exclude []string, subtype string, want bool) {
+		t.Helper()
+		origInclude, origExclude := *includeSubtypes, *excludeSubtypes
+		defer func() {
+			*includeSubtypes, *excludeSubtypes = origInclude, origExclude
+		}()
+		*includeSubtypes, *excludeSubtypes = include, exclude
+		if got := subtypeAllowed(subtype); got != want {
+			t.Fatalf("subtypeAllowed(%q) with include=%q, exclude=%q = %v, want %v", subtype, include, exclude, got, want)
+		}
+	}
+	// default filters
+	f(nil, nil, "", true)
+	f(nil, nil, "channel_join", false)
+	f(nil, nil, "channel_topic", false)
+	f(nil, nil, "thread_broadcast", true)
+	f(nil, nil, "bot_message", true)
+
+	// exclude list replaces the default one
+	f(nil, []string{"file_share"}, "file_share", false)
+	f(nil, []string{"file_share"}, "channel_join", true)
+
+	// include list allows only the listed subtypes
+	f([]string{"channel_join"}, nil, "channel_join", true)
+	f([]string{"channel_join"}, nil, "channel_leave", false)
+	f([]string{"channel_join"}, nil, "", true)
+	f([]string{"channel_join", "channel_leave"}, []string{"channel_leave"}, "channel_leave", false)
+}
+
+// Test for parseTimestamp function
+func TestParseTimestamp(t *testing.T) {
+	f := func(ts, want string) {
+		t.Helper()
+		got, err := parseTimestamp(ts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", ts, err)
+		}
+		if s := got.Format(time.RFC3339Nano); s != want {
+			t.Fatalf("unexpected time for %q; got %q; want %q", ts, s, want)
+		}
+	}
+	f("1705399200.000100", "2024-01-16T10:00:00.0001Z")
+	f("1705399200.999999", "2024-01-16T10:00:00.999999Z")
+	f("1705399200", "2024-01-16T10:00:00Z")
+
+	for _, ts := range []string{"", "abc", "1705399200.-1", "1705399200.1234567890"} {
+		if _, err := parseTimestamp(ts); err == nil {
+			t.Errorf("expecting non-nil error for %q", ts)
+		}
 	}
-	for _, tt := range tests {
-		if got := filterOutLogMessage(tt.message); got != tt.want {
-			t.Errorf("filterOutLogMessage(%q) = %v, want %v", tt.message, got, tt.want)
+}
+
+// Test for permalink function
+func TestPermalink(t *testing.T) {
+	f := func(workspaceURL, ts, threadTS, want string) {
+		t.Helper()
+		if got := permalink(workspaceURL, "C1", ts, threadTS); got != want {
+			t.Fatalf("unexpected permalink; got %q; want %q", got, want)
+		}
+	}
+	f("https://example.slack.com/", "1705399200.000100", "", "https://example.slack.com/archives/C1/p1705399200000100")
+	f("https://example.slack.com", "1705399200.000100", "1705399200.000100", "https://example.slack.com/archives/C1/p1705399200000100")
+	f("https://example.slack.com/", "1705399300.000200", "1705399200.000100",
+		"https://example.slack.com/archives/C1/p1705399300000200?cid=C1&thread_ts=1705399200.000100")
+	f("", "1705399200.000100", "", "")
+}
+
+// Test for Client.collectHistoricalMessages method paginating history and thread replies
+func TestCollectHistoricalMessages(t *testing.T) {
+	mustInitPolicy()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse request: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		cursor := r.Form.Get("cursor")
+		switch r.URL.Path {
+		case "/conversations.history":
+			switch cursor {
+			case "":
+				_, _ = w.Write([]byte(`{"ok":true,"has_more":true,"response_metadata":{"next_cursor":"h2"},"messages":[
+					{"type":"message","user":"U1","text":"second","ts":"1705399300.000100"}
+				]}`))
+			case "h2":
+				_, _ = w.Write([]byte(`{"ok":true,"has_more":false,"messages":[
+					{"type":"message","user":"U1","text":"root","ts":"1705399200.000100","thread_ts":"1705399200.000100","reply_count":2}
+				]}`))
+			default:
+				t.Errorf("unexpected history cursor %q", cursor)
+			}
+		case "/conversations.replies":
+			switch cursor {
+			case "":
+				_, _ = w.Write([]byte(`{"ok":true,"has_more":true,"response_metadata":{"next_cursor":"r2"},"messages":[
+					{"type":"message","user":"U1","text":"root","ts":"1705399200.000100","thread_ts":"1705399200.000100","reply_count":2},
+					{"type":"message","user":"U1","text":"reply 1","ts":"1705399210.000100","thread_ts":"1705399200.000100"}
+				]}`))
+			case "r2":
+				_, _ = w.Write([]byte(`{"ok":true,"has_more":false,"messages":[
+					{"type":"message","user":"U1","text":"reply 2","ts":"1705399220.000100","thread_ts":"1705399200.000100"}
+				]}`))
+			default:
+				t.Errorf("unexpected replies cursor %q", cursor)
+			}
+		case "/users.info":
+			_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1","team_id":"T1","profile":{"display_name":"alice"}}}`))
+		case "/conversations.info":
+			_, _ = w.Write([]byte(`{"ok":true,"channel":{"id":"C1","name":"general"}}`))
+		default:
+			t.Errorf("unexpected request to %q", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		api:               slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		messageC:          make(chan transporter.Message, 1),
+		threadC:           make(chan ThreadRequest, 1),
+		listeningChannels: map[string]struct{}{"C1": {}},
+		workspace:         workspace{teamID: "T1"},
+	}
+	go c.collectHistoricalMessages(context.Background())
+	var got []string
+	for m := range c.messageC {
+		got = append(got, m.Text)
+	}
+	sort.Strings(got)
+	want := []string{"reply 1", "reply 2", "root", "second"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected messages; got %q; want %q", got, want)
+	}
+}
+
+// Test for ignoring legal hold of channels outside the channel list of the workspace
+func TestHandleEventMessageLegalHold(t *testing.T) {
+	mustInitPolicy()
+	origLegalHold := globalPolicy.legalHoldChannels.Load()
+	defer globalPolicy.legalHoldChannels.Store(origLegalHold)
+	legalHold := idSet{"C1": {}, "C2": {}}
+	globalPolicy.legalHoldChannels.Store(&legalHold)
+
+	c := &Client{
+		listeningChannels: map[string]struct{}{"C1": {}},
+		workspace:         workspace{teamID: "T1"},
+		batch:             make(Messages),
+	}
+	f := func(data string, wantPermanent bool) {
+		t.Helper()
+		event, err := slackevents.ParseEvent(json.RawMessage(data), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			t.Fatalf("cannot parse event: %s", err)
+		}
+		err = c.handleEventMessage(context.Background(), event)
+		var pe *permanentError
+		if errors.As(err, &pe) != wantPermanent {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(c.batch) != 0 {
+			t.Fatalf("unexpected messages in the batch: %v", c.batch)
 		}
 	}
+	// C2 is on legal hold, but it isn't in the channel list
+	f(`{"type":"event_callback","team_id":"T1","event":{"type":"message","channel":"C2","user":"U1","text":"hello","ts":"1705399200.000100","channel_type":"channel"}}`, true)
+	f(`{"type":"event_callback","team_id":"T1","event":{"type":"channel_archive","channel":"C2","user":"U1","event_ts":"1705399200.000100"}}`, false)
 }
@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"slack2logs/envtemplate"
+)
+
+var workspacesConfig = flag.String("slack.workspacesConfig", "", "Path to the YAML file with the list of Slack workspaces to collect messages from. "+
+	"Every workspace has its own tokens and channels. It cannot be used together with -slack.auth.* and -slack.channels flags. "+
+	"The file may contain %{ENV_VAR} placeholders, which are substituted by the corresponding env vars")
+
+// Config represents a list of Slack workspaces
+type Config struct {
+	Workspaces []WorkspaceConfig `yaml:"workspaces"`
+}
+
+// WorkspaceConfig represents configuration of a single Slack workspace
+type WorkspaceConfig struct {
+	// Name is used in logs and in the Events API path if -slack.mode=http
+	Name     string `yaml:"name"`
+	BotToken string `yaml:"bot_token,omitempty"`
+	// UserToken is used instead of BotToken for reading private channels and direct messages.
+	// Conversations are obtained via users.conversations if Channels is empty
+	UserToken     string   `yaml:"user_token,omitempty"`
+	AppToken      string   `yaml:"app_token,omitempty"`
+	SigningSecret string   `yaml:"signing_secret,omitempty"`
+	Channels      []string `yaml:"channels"`
+	// URL is used for building message permalinks. It is obtained via auth.test if empty
+	URL string `yaml:"url,omitempty"`
+}
+
+// loadConfig reads workspaces configuration from the given path
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	data, err = envtemplate.ReplaceBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand environment variables in %q: %w", path, err)
+	}
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse workspaces config: %w", err)
+	}
+	if len(cfg.Workspaces) == 0 {
+		return nil, fmt.Errorf("at least one workspace must be defined")
+	}
+	names := make(map[string]struct{}, len(cfg.Workspaces))
+	for i, ws := range cfg.Workspaces {
+		if ws.Name == "" {
+			return nil, fmt.Errorf("missing `name` for workspace #%d", i+1)
+		}
+		if _, ok := names[ws.Name]; ok {
+			return nil, fmt.Errorf("duplicate workspace name %q", ws.Name)
+		}
+		names[ws.Name] = struct{}{}
+		if ws.BotToken == "" && ws.UserToken == "" {
+			return nil, fmt.Errorf("missing `bot_token` or `user_token` for workspace %q", ws.Name)
+		}
+		if ws.BotToken != "" && ws.UserToken != "" {
+			return nil, fmt.Errorf("`bot_token` and `user_token` cannot be set simultaneously for workspace %q", ws.Name)
+		}
+		if len(ws.Channels) == 0 && ws.UserToken == "" {
+			return nil, fmt.Errorf("at least one channel must be defined for workspace %q without `user_token`", ws.Name)
+		}
+	}
+	return &cfg, nil
+}
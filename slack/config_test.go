@@ -0,0 +1,49 @@
+package slack
+
+import "testing"
+
+// Test for parseConfig function
+func TestParseConfig(t *testing.T) {
+	data := []byte(`
+workspaces:
+  - name: main
+    bot_token: xoxb-main
+    app_token: xapp-main
+    channels: [C1, C2]
+  - name: support
+    bot_token: xoxb-support
+    signing_secret: secret
+    channels:
+      - C3
+`)
+	cfg, err := parseConfig(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cfg.Workspaces) != 2 {
+		t.Fatalf("unexpected number of workspaces; got %d; want 2", len(cfg.Workspaces))
+	}
+	ws := cfg.Workspaces[1]
+	if ws.Name != "support" || ws.BotToken != "xoxb-support" || ws.SigningSecret != "secret" || len(ws.Channels) != 1 {
+		t.Fatalf("unexpected workspace config: %+v", ws)
+	}
+}
+
+// Test for parseConfig function with invalid configs
+func TestParseConfigFailure(t *testing.T) {
+	tests := []string{
+		``,
+		`workspaces: []`,
+		`workspaces: [{bot_token: xoxb, channels: [C1]}]`,
+		`workspaces: [{name: main, channels: [C1]}]`,
+		`workspaces: [{name: main, bot_token: xoxb}]`,
+		`workspaces: [{name: main, bot_token: xoxb, user_token: xoxp, channels: [C1]}]`,
+		`workspaces: [{name: main, bot_token: xoxb, channels: [C1]}, {name: main, bot_token: xoxb, channels: [C2]}]`,
+		`workspaces: [{name: main, bot_token: xoxb, channels: [C1], unknown: field}]`,
+	}
+	for _, tt := range tests {
+		if _, err := parseConfig([]byte(tt)); err == nil {
+			t.Errorf("expecting non-nil error for config %q", tt)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/slack-go/slack"
+
+	"slack2logs/flagutil"
+)
+
+var (
+	conversationTypes = flagutil.NewArrayString("slack.conversationTypes", "Types of conversations to collect messages from if -slack.auth.userToken is set and no channels are defined. "+
+		"Conversations are obtained via users.conversations. Supported values: public_channel, private_channel, mpim, im. Defaults to public_channel,private_channel if empty")
+	dmsIncludeChannels = flagutil.NewArrayString("slack.dms.includeChannels", "Ids of direct message and multi-person direct message conversations to export messages from. "+
+		"Messages from such conversations are never exported if they aren't listed here, regardless of other settings")
+)
+
+// Conversation types as defined in https://api.slack.com/methods/users.conversations
+const (
+	conversationPublic  = "public_channel"
+	conversationPrivate = "private_channel"
+	conversationMPIM    = "mpim"
+	conversationIM      = "im"
+)
+
+var supportedConversationTypes = []string{conversationPublic, conversationPrivate, conversationMPIM, conversationIM}
+
+const conversationsRequestLimit = 200
+
+// conversationType returns the type of the conversation ch
+func conversationType(ch *slack.Channel) string {
+	switch {
+	case ch.IsIM:
+		return conversationIM
+	case ch.IsMpIM:
+		return conversationMPIM
+	case ch.IsPrivate || ch.IsGroup:
+		return conversationPrivate
+	default:
+		return conversationPublic
+	}
+}
+
+// conversationTypeFromEvent returns conversation type for the channel_type of message event
+func conversationTypeFromEvent(channelType string) string {
+	switch channelType {
+	case "im":
+		return conversationIM
+	case "mpim":
+		return conversationMPIM
+	case "group":
+		return conversationPrivate
+	default:
+		return conversationPublic
+	}
+}
+
+// dmAllowed reports whether messages from the conversation with the given id and type may be exported.
+// Direct messages are exported only if they are listed in -slack.dms.includeChannels.
+func dmAllowed(channelID, typ string) bool {
+	if typ != conversationIM && typ != conversationMPIM {
+		return true
+	}
+	return slices.Contains(*dmsIncludeChannels, channelID)
+}
+
+// discoverConversations adds conversations of the user the token belongs to
+// with types defined via -slack.conversationTypes to the listened channels
+func (c *Client) discoverConversations(ctx context.Context) error {
+	types := *conversationTypes
+	if len(types) == 0 {
+		types = []string{conversationPublic, conversationPrivate}
+	}
+	for _, typ := range types {
+		if !slices.Contains(supportedConversationTypes, typ) {
+			return fmt.Errorf("unsupported -slack.conversationTypes=%q; supported values: %s", typ, supportedConversationTypes)
+		}
+	}
+	params := &slack.GetConversationsForUserParameters{
+		Types: types,
+		Limit: conversationsRequestLimit,
+	}
+	for {
+		channels, cursor, err := c.api.GetConversationsForUserContext(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error get conversations via users.conversations: %w", err)
+		}
+		for i := range channels {
+			ch := &channels[i]
+			typ := conversationType(ch)
+			if !dmAllowed(ch.ID, typ) {
+				continue
+			}
+			c.listeningChannels[ch.ID] = struct{}{}
+			c.setChannelInfo(ch.ID, channelInfo{name: ch.Name, typ: typ})
+		}
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	log.Printf("%sfound %d conversations via users.conversations", c.logPrefix(), len(c.listeningChannels))
+	return nil
+}
+
+// dropDisallowedDMs removes direct messages missing in -slack.dms.includeChannels from the listened channels
+func (c *Client) dropDisallowedDMs(ctx context.Context) error {
+	for channelID := range c.listeningChannels {
+		info, err := c.channelInfo(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if !dmAllowed(channelID, info.typ) {
+			log.Printf("%sskipping %s conversation %q, since it is missing in -slack.dms.includeChannels", c.logPrefix(), info.typ, channelID)
+			delete(c.listeningChannels, channelID)
+		}
+	}
+	return nil
+}
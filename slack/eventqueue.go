@@ -0,0 +1,219 @@
+package slack
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+var (
+	eventsQueueSize = flag.Int("slack.events.queueSize", 1000, "The maximum number of Socket Mode and Events API events queued for handling and for retrying. "+
+		"Events are acknowledged once they are queued, so Slack doesn't redeliver them while they are handled. "+
+		"The queue is kept in memory, so queued events are lost on restart and their messages are recovered only via catching up, see -slack.catchup.*")
+	eventsMaxRetries = flag.Int("slack.events.maxRetries", 5, "The maximum number of retries for handling a queued event, "+
+		"for example, when the author of the message cannot be obtained via Slack API")
+	eventsDedupCacheSize = flag.Int("slack.events.dedupCacheSize", 10000, "The number of the most recent event_id values to remember "+
+		"for dropping events redelivered by Slack")
+)
+
+var (
+	eventsDuplicatesCount = metrics.GetOrCreateCounter(`vm_slack2logs_events_duplicates_total`)
+	eventsRetriesCount    = metrics.GetOrCreateCounter(`vm_slack2logs_events_retries_total`)
+	eventsDroppedCount    = metrics.GetOrCreateCounter(`vm_slack2logs_events_dropped_total`)
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// permanentError is returned from event handling if retrying cannot help
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// notFoundErrors contains Slack API errors returned for deleted users, bots and channels
+var notFoundErrors = map[string]bool{
+	"user_not_found":    true,
+	"users_not_found":   true,
+	"bot_not_found":     true,
+	"channel_not_found": true,
+}
+
+// permanentIfNotFound wraps err into permanentError if it is returned by Slack API for deleted objects
+func permanentIfNotFound(err error) error {
+	var se slack.SlackErrorResponse
+	if errors.As(err, &se) && notFoundErrors[se.Err] {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// queuedEvent is an event waiting for the next handling attempt
+type queuedEvent struct {
+	event slackevents.EventsAPIEvent
+	// attempt is the number of failed handling attempts
+	attempt int
+}
+
+// eventID returns event_id of the Events API callback event. It returns empty string for other events
+func eventID(event slackevents.EventsAPIEvent) string {
+	cb, ok := event.Data.(*slackevents.EventsAPICallbackEvent)
+	if !ok {
+		return ""
+	}
+	return cb.EventID
+}
+
+// enqueueEvent adds event to the queue unless it was already received.
+// It returns false if ctx is done before the event is queued.
+func (c *Client) enqueueEvent(ctx context.Context, event slackevents.EventsAPIEvent) bool {
+	id := eventID(event)
+	if id != "" && !c.seenEvents.add(id) {
+		// Slack redelivers events if they aren't acknowledged in time
+		eventsDuplicatesCount.Inc()
+		return true
+	}
+	select {
+	case c.eventsC <- event:
+		return true
+	case <-ctx.Done():
+		// the event isn't acknowledged, so its redelivery must be accepted
+		if id != "" {
+			c.seenEvents.remove(id)
+		}
+		return false
+	}
+}
+
+// processEvents handles queued events until ctx is done.
+// Events are handled sequentially in the order of arrival. Failed events are retried by a separate goroutine,
+// so they don't block the queue. Retried messages don't override newer revisions, see addToBatch.
+func (c *Client) processEvents(ctx context.Context) {
+	go c.processRetries(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-c.eventsC:
+			c.handleQueuedEvent(ctx, queuedEvent{event: event})
+		}
+	}
+}
+
+// processRetries handles events scheduled for retrying via scheduleRetry until ctx is done
+func (c *Client) processRetries(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case qe := <-c.retryC:
+			c.pendingRetries.Add(-1)
+			eventsRetriesCount.Inc()
+			c.handleQueuedEvent(ctx, qe)
+		}
+	}
+}
+
+// handleQueuedEvent handles the event and schedules retry on temporary errors
+func (c *Client) handleQueuedEvent(ctx context.Context, qe queuedEvent) {
+	err := c.handleEventMessage(ctx, qe.event)
+	if err == nil {
+		return
+	}
+	log.Printf("%serror handle event message: %s", c.logPrefix(), err)
+	handleMessageErrors.Inc()
+	var pe *permanentError
+	if errors.As(err, &pe) || errors.Is(err, context.Canceled) {
+		return
+	}
+	c.scheduleRetry(ctx, qe, err)
+}
+
+// scheduleRetry queues the event for retrying with exponential backoff according to -slack.events.maxRetries.
+// The event is dropped if the number of events waiting for retries reaches -slack.events.queueSize.
+func (c *Client) scheduleRetry(ctx context.Context, qe queuedEvent, err error) {
+	if qe.attempt >= *eventsMaxRetries {
+		log.Printf("%sdrop event %s after %d retries", c.logPrefix(), eventID(qe.event), qe.attempt)
+		eventsDroppedCount.Inc()
+		return
+	}
+	if c.pendingRetries.Add(1) > int64(cap(c.retryC)) {
+		c.pendingRetries.Add(-1)
+		log.Printf("%sdrop event %s, since too many events wait for retries; see -slack.events.queueSize", c.logPrefix(), eventID(qe.event))
+		eventsDroppedCount.Inc()
+		return
+	}
+	// the shift is limited for avoiding overflow, since maxRetryDelay is reached after 6 attempts
+	d := min(minRetryDelay<<min(qe.attempt, 6), maxRetryDelay)
+	var rle *slack.RateLimitedError
+	if errors.As(err, &rle) && rle.RetryAfter > d {
+		d = rle.RetryAfter
+	}
+	qe.attempt++
+	time.AfterFunc(d, func() {
+		// the send doesn't block, since the number of pending retries doesn't exceed the channel capacity
+		select {
+		case c.retryC <- qe:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// lruSet is a set of strings of limited size. The least recently added strings are evicted first
+type lruSet struct {
+	maxSize int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+func newLRUSet(maxSize int) *lruSet {
+	return &lruSet{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// add adds s to the set. It returns false if s is already in the set
+func (ls *lruSet) add(s string) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if e, ok := ls.items[s]; ok {
+		ls.order.MoveToFront(e)
+		return false
+	}
+	if ls.maxSize <= 0 {
+		return true
+	}
+	ls.items[s] = ls.order.PushFront(s)
+	if ls.order.Len() > ls.maxSize {
+		e := ls.order.Back()
+		ls.order.Remove(e)
+		delete(ls.items, e.Value.(string))
+	}
+	return true
+}
+
+// remove removes s from the set
+func (ls *lruSet) remove(s string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if e, ok := ls.items[s]; ok {
+		ls.order.Remove(e)
+		delete(ls.items, s)
+	}
+}
@@ -0,0 +1,149 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+// Test for lruSet.add method
+func TestLRUSet(t *testing.T) {
+	ls := newLRUSet(2)
+	if !ls.add("a") || !ls.add("b") {
+		t.Fatalf("expecting new items to be added")
+	}
+	if ls.add("a") {
+		t.Fatalf("expecting duplicate item to be detected")
+	}
+	// b is evicted as the least recently used item
+	if !ls.add("c") {
+		t.Fatalf("expecting new item to be added")
+	}
+	if !ls.add("b") {
+		t.Fatalf("expecting evicted item to be added again")
+	}
+	if ls.add("c") {
+		t.Fatalf("expecting duplicate item to be detected")
+	}
+}
+
+// Test for Client.enqueueEvent method
+func TestEnqueueEvent(t *testing.T) {
+	c := &Client{
+		eventsC:    make(chan slackevents.EventsAPIEvent, 2),
+		seenEvents: newLRUSet(10),
+	}
+	newEvent := func(id string) slackevents.EventsAPIEvent {
+		return slackevents.EventsAPIEvent{
+			Type: slackevents.CallbackEvent,
+			Data: &slackevents.EventsAPICallbackEvent{EventID: id},
+		}
+	}
+	ctx := context.Background()
+	for _, id := range []string{"Ev1", "Ev2", "Ev1"} {
+		if !c.enqueueEvent(ctx, newEvent(id)) {
+			t.Fatalf("expecting event %s to be acknowledged", id)
+		}
+	}
+	if len(c.eventsC) != 2 {
+		t.Fatalf("unexpected number of queued events; got %d; want 2", len(c.eventsC))
+	}
+
+	// the event isn't acknowledged if it cannot be queued
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if c.enqueueEvent(ctx, newEvent("Ev3")) {
+		t.Fatalf("expecting event to be rejected when the queue is full")
+	}
+	// the redelivery of the rejected event is queued
+	<-c.eventsC
+	if !c.enqueueEvent(context.Background(), newEvent("Ev3")) || len(c.eventsC) != 2 {
+		t.Fatalf("expecting redelivered event to be queued")
+	}
+}
+
+// Test for permanent errors returned from Client.handleEventMessage
+func TestHandleEventMessagePermanentErrors(t *testing.T) {
+	c := &Client{batch: make(Messages)}
+	f := func(event slackevents.EventsAPIEvent) {
+		t.Helper()
+		err := c.handleEventMessage(context.Background(), event)
+		var pe *permanentError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expecting permanentError; got %v", err)
+		}
+	}
+	f(slackevents.EventsAPIEvent{Type: "unknown"})
+	f(slackevents.EventsAPIEvent{
+		Type:       slackevents.CallbackEvent,
+		InnerEvent: slackevents.EventsAPIInnerEvent{Type: "reaction_added", Data: &slackevents.ReactionAddedEvent{}},
+	})
+
+	if err := permanentIfNotFound(fmt.Errorf("error get user: %w", slack.SlackErrorResponse{Err: "user_not_found"})); !errors.As(err, new(*permanentError)) {
+		t.Fatalf("expecting permanentError for deleted user; got %v", err)
+	}
+	if err := permanentIfNotFound(slack.SlackErrorResponse{Err: "internal_error"}); errors.As(err, new(*permanentError)) {
+		t.Fatalf("unexpected permanentError for temporary error: %v", err)
+	}
+}
+
+// Test for Client.scheduleRetry method
+func TestScheduleRetry(t *testing.T) {
+	origMaxRetries := *eventsMaxRetries
+	defer func() { *eventsMaxRetries = origMaxRetries }()
+	*eventsMaxRetries = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Client{retryC: make(chan queuedEvent, 1)}
+	event := slackevents.EventsAPIEvent{Type: slackevents.CallbackEvent, Data: &slackevents.EventsAPICallbackEvent{EventID: "Ev1"}}
+	err := errors.New("temporary error")
+
+	// the event exceeding -slack.events.maxRetries is dropped
+	c.scheduleRetry(ctx, queuedEvent{event: event, attempt: 2}, err)
+	if n := c.pendingRetries.Load(); n != 0 {
+		t.Fatalf("unexpected number of pending retries; got %d; want 0", n)
+	}
+
+	c.scheduleRetry(ctx, queuedEvent{event: event}, err)
+	// the event is dropped, since the retry queue is full
+	c.scheduleRetry(ctx, queuedEvent{event: event}, err)
+	if n := c.pendingRetries.Load(); n != 1 {
+		t.Fatalf("unexpected number of pending retries; got %d; want 1", n)
+	}
+	select {
+	case qe := <-c.retryC:
+		if qe.attempt != 1 || eventID(qe.event) != "Ev1" {
+			t.Fatalf("unexpected retried event: %+v", qe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for the retried event")
+	}
+}
+
+// Test for Client.addToBatch method
+func TestAddToBatch(t *testing.T) {
+	c := &Client{batch: make(Messages)}
+	edited := transporter.Message{Type: "message", MessageTS: "1705399200.000100", EditedTS: "1705399300.000100", Text: "edited"}
+	original := transporter.Message{Type: "message", MessageTS: "1705399200.000100", Text: "original"}
+	// the original message is retried after its edit was received
+	c.addToBatch(edited)
+	c.addToBatch(original)
+	if m := c.batch["1705399200.000100"]; m.Text != "edited" {
+		t.Fatalf("unexpected message in the batch: %+v", m)
+	}
+	edited2 := edited
+	edited2.EditedTS = "1705399400.000100"
+	edited2.Text = "edited again"
+	c.addToBatch(edited2)
+	if m := c.batch["1705399200.000100"]; m.Text != "edited again" {
+		t.Fatalf("unexpected message in the batch: %+v", m)
+	}
+}
@@ -0,0 +1,107 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// EventsPath is the http path for receiving Slack Events API requests
+// if -slack.mode=http is set.
+const EventsPath = "/slack/events"
+
+// maxEventRequestSize limits the size of the Events API request body
+const maxEventRequestSize = 1 << 20
+
+// EventsHandler returns http path and handler for Slack Events API requests.
+// The path is EventsPath for the workspace configured via command-line flags
+// and EventsPath/<name> for workspaces from -slack.workspacesConfig.
+// It returns nil handler if the client doesn't run in the http mode.
+func (c *Client) EventsHandler() (string, http.Handler) {
+	if c.socketClient != nil {
+		return "", nil
+	}
+	path := EventsPath
+	if c.name != "" {
+		path += "/" + c.name
+	}
+	return path, http.HandlerFunc(c.handleEventsRequest)
+}
+
+func (c *Client) handleEventsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("unsupported method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEventRequestSize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("error read request body: %w", err))
+		return
+	}
+	if err := c.verifyRequest(r.Header, body); err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(body, slackevents.OptionNoVerifyToken())
+	if err != nil {
+		// the request is signed by Slack, so its redelivery cannot help.
+		// Such requests include events of types unsupported by slack-go
+		ignoreEvent(w, fmt.Errorf("error parse event: %w", err))
+		return
+	}
+	switch event.Type {
+	case slackevents.URLVerification:
+		var cr slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &cr); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("error parse url verification request: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(cr.Challenge))
+	case slackevents.CallbackEvent:
+		// Slack redelivers the event with X-Slack-Retry-Num header if it isn't acknowledged within 3 seconds,
+		// so the event is acknowledged once it is queued. Redelivered events are dropped by event_id.
+		// Handling errors are retried internally
+		if !c.enqueueEvent(r.Context(), event) {
+			respondWithError(w, http.StatusServiceUnavailable, fmt.Errorf("cannot queue event %s: %w", eventID(event), r.Context().Err()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		ignoreEvent(w, fmt.Errorf("unsupported event type %q", event.Type))
+	}
+}
+
+// ignoreEvent logs err and acknowledges the event, which cannot be handled, so Slack doesn't redeliver it
+func ignoreEvent(w http.ResponseWriter, err error) {
+	log.Printf("error handle Events API request: %s", err)
+	handleMessageErrors.Inc()
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyRequest checks the request signature with the signing secret
+// See https://api.slack.com/authentication/verifying-requests-from-slack
+func (c *Client) verifyRequest(header http.Header, body []byte) error {
+	verifier, err := slack.NewSecretsVerifier(header, c.signingSecret)
+	if err != nil {
+		return fmt.Errorf("error create request verifier: %w", err)
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return fmt.Errorf("error verify request body: %w", err)
+	}
+	if err := verifier.Ensure(); err != nil {
+		return fmt.Errorf("error verify request signature: %w", err)
+	}
+	return nil
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, err error) {
+	log.Printf("error handle Events API request: %s", err)
+	http.Error(w, err.Error(), statusCode)
+}
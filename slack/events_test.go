@@ -0,0 +1,91 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+const testSigningSecret = "test-signing-secret"
+
+// sendEventsRequest sends signed Events API request with the given body to c.
+// The request is signed with testSigningSecret if signature is empty
+func sendEventsRequest(t *testing.T, c *Client, body, signature string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	if signature == "" {
+		mac := hmac.New(sha256.New, []byte(testSigningSecret))
+		mac.Write([]byte("v0:" + ts + ":" + body))
+		signature = "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	req := httptest.NewRequest(http.MethodPost, EventsPath, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", signature)
+	w := httptest.NewRecorder()
+	c.handleEventsRequest(w, req)
+	return w
+}
+
+// Test for Client.handleEventsRequest url verification and signature checks
+func TestHandleEventsRequest(t *testing.T) {
+	c := &Client{signingSecret: testSigningSecret}
+	body := `{"token":"tok","challenge":"challenge-value","type":"url_verification"}`
+
+	f := func(signature string, wantCode int, wantBody string) {
+		t.Helper()
+		w := sendEventsRequest(t, c, body, signature, nil)
+		if w.Code != wantCode {
+			t.Fatalf("unexpected response code; got %d; want %d", w.Code, wantCode)
+		}
+		if wantBody != "" && w.Body.String() != wantBody {
+			t.Fatalf("unexpected response body; got %q; want %q", w.Body.String(), wantBody)
+		}
+	}
+
+	// valid signature
+	f("", http.StatusOK, "challenge-value")
+	// invalid signature
+	f("v0=0123456789abcdef", http.StatusUnauthorized, "")
+}
+
+// Test for Client.handleEventsRequest queueing callback events
+func TestHandleEventsRequestCallback(t *testing.T) {
+	c := &Client{
+		signingSecret: testSigningSecret,
+		eventsC:       make(chan slackevents.EventsAPIEvent, 10),
+		seenEvents:    newLRUSet(10),
+	}
+	newBody := func(eventID, eventType string) string {
+		return `{"token":"tok","team_id":"T1","type":"event_callback","event_id":"` + eventID + `","event_time":1705399200,` +
+			`"event":{"type":"` + eventType + `","channel":"C1","user":"U1","text":"hello","ts":"1705399200.000100"}}`
+	}
+	f := func(body string, header http.Header, wantQueued int) {
+		t.Helper()
+		w := sendEventsRequest(t, c, body, "", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected response code; got %d; want %d", w.Code, http.StatusOK)
+		}
+		if len(c.eventsC) != wantQueued {
+			t.Fatalf("unexpected number of queued events; got %d; want %d", len(c.eventsC), wantQueued)
+		}
+	}
+
+	f(newBody("Ev1", "message"), nil, 1)
+	// the redelivered event is acknowledged and dropped
+	f(newBody("Ev1", "message"), http.Header{"X-Slack-Retry-Num": {"1"}, "X-Slack-Retry-Reason": {"http_timeout"}}, 1)
+	// unsupported events are acknowledged, so Slack doesn't redeliver them
+	f(newBody("Ev2", "unsupported_event"), nil, 1)
+	f(`{"token":"tok","type":"unsupported_type"}`, nil, 1)
+	f(newBody("Ev3", "message"), nil, 2)
+}
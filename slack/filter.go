@@ -0,0 +1,70 @@
+package slack
+
+import (
+	"slices"
+
+	"github.com/slack-go/slack"
+
+	"slack2logs/flagutil"
+)
+
+var (
+	includeSubtypes = flagutil.NewArrayString("slack.includeSubtypes", "Optional message subtypes to export, for example channel_join,channel_topic. "+
+		"Messages without subtype are always exported. Messages with other subtypes are dropped if this flag is set. "+
+		"See https://api.slack.com/events/message#subtypes")
+	excludeSubtypes = flagutil.NewArrayString("slack.excludeSubtypes", "Optional message subtypes to drop. "+
+		"System messages such as channel joins, leaves, topic and purpose changes and pins are dropped if neither -slack.excludeSubtypes nor -slack.includeSubtypes is set")
+)
+
+// defaultExcludedSubtypes contains subtypes of system messages,
+// which are dropped by default
+var defaultExcludedSubtypes = []string{
+	slack.MsgSubTypeChannelJoin,
+	slack.MsgSubTypeChannelLeave,
+	slack.MsgSubTypeChannelTopic,
+	slack.MsgSubTypeChannelPurpose,
+	slack.MsgSubTypeChannelName,
+	slack.MsgSubTypeChannelArchive,
+	slack.MsgSubTypeChannelUnarchive,
+	slack.MsgSubTypeGroupJoin,
+	slack.MsgSubTypeGroupLeave,
+	slack.MsgSubTypeGroupTopic,
+	slack.MsgSubTypeGroupPurpose,
+	slack.MsgSubTypeGroupName,
+	slack.MsgSubTypeGroupArchive,
+	slack.MsgSubTypeGroupUnarchive,
+	slack.MsgSubTypePinnedItem,
+	slack.MsgSubTypeUnpinnedItem,
+	slack.MsgSubTypeChannelPostingPermissions,
+	slack.MsgSubTypeMessageDeleted,
+	slack.MsgSubTypeMessageReplied,
+}
+
+// isFiltered reports whether msg from channelID must be dropped
+// according to subtype and bot filters.
+// The same filters are applied to live events, backfilling and archive import.
+func isFiltered(channelID string, msg *slack.Msg) bool {
+	if !subtypeAllowed(msg.SubType) {
+		return true
+	}
+	return isBotMessage(msg) && !botMessagesAllowed(channelID)
+}
+
+// subtypeAllowed reports whether messages with the given subtype can be exported
+// according to -slack.includeSubtypes and -slack.excludeSubtypes
+func subtypeAllowed(subtype string) bool {
+	if subtype == "" {
+		return true
+	}
+	excluded := *excludeSubtypes
+	if len(excluded) == 0 && len(*includeSubtypes) == 0 {
+		excluded = defaultExcludedSubtypes
+	}
+	if slices.Contains(excluded, subtype) {
+		return false
+	}
+	if len(*includeSubtypes) > 0 {
+		return slices.Contains(*includeSubtypes, subtype)
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// errStopIteration may be returned by callbacks passed to forEachHistoryMessage and forEachReply for stopping the iteration
+var errStopIteration = errors.New("stop iteration")
+
+// forEachHistoryMessage calls f for every message from channelID posted between oldest and latest
+// obtained via conversations.history. Empty oldest and latest mean no limits.
+// The iteration stops on the first error returned by f.
+func (c *Client) forEachHistoryMessage(ctx context.Context, channelID, oldest, latest string, f func(msg *slack.Msg) error) error {
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Oldest:    oldest,
+		Latest:    latest,
+		Limit:     historicalRequestLimit,
+	}
+	for {
+		resp, err := c.api.GetConversationHistoryContext(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error get history of channel %q: %w", channelID, err)
+		}
+		for i := range resp.Messages {
+			if err := f(&resp.Messages[i].Msg); err != nil {
+				return err
+			}
+		}
+		if !resp.HasMore {
+			return nil
+		}
+		params.Cursor = resp.ResponseMetaData.NextCursor
+	}
+}
+
+// forEachReply calls f for every reply to the thread threadTS from channelID posted after oldest
+// obtained via conversations.replies. The thread root is skipped, since it is returned by conversations.history.
+// The iteration stops on the first error returned by f.
+func (c *Client) forEachReply(ctx context.Context, channelID, threadTS, oldest string, f func(msg *slack.Msg) error) error {
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: channelID,
+		Timestamp: threadTS,
+		Oldest:    oldest,
+		Limit:     historicalRequestLimit,
+	}
+	for {
+		replies, hasMore, cursor, err := c.api.GetConversationRepliesContext(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error get replies for thread %s in channel %q: %w", threadTS, channelID, err)
+		}
+		for i := range replies {
+			if replies[i].Timestamp == threadTS {
+				continue
+			}
+			if err := f(&replies[i].Msg); err != nil {
+				return err
+			}
+		}
+		if !hasMore {
+			return nil
+		}
+		params.Cursor = cursor
+	}
+}
@@ -0,0 +1,153 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+// workspace contains workspace info, which is added to every message
+type workspace struct {
+	teamID   string
+	teamName string
+	// url is used for building permalinks
+	url string
+}
+
+// buildMessage resolves the author and the channel of Slack message msg
+// and converts it into transporter.Message.
+// Messages from bots, workflows and integrations may have no user, so the bot is resolved for them instead.
+func (c *Client) buildMessage(ctx context.Context, channelID string, msg *userMessage) (transporter.Message, error) {
+	if msg.User == "" && msg.BotID == "" {
+		return transporter.Message{}, &permanentError{fmt.Errorf("message %s has neither user nor bot_id", msg.Timestamp)}
+	}
+	var user *slack.User
+	if msg.User != "" {
+		u, err := c.getUser(ctx, msg.User, msg.UserTeam, msg.UserProfile)
+		if err != nil {
+			return transporter.Message{}, fmt.Errorf("error get author of message %s: %w", msg.Timestamp, err)
+		}
+		user = u
+	}
+	var bot *slack.Bot
+	if msg.BotID != "" {
+		b, err := c.getBot(ctx, &msg.Msg)
+		if err != nil {
+			return transporter.Message{}, err
+		}
+		bot = b
+	}
+	info, err := c.channelInfo(ctx, channelID)
+	if err != nil {
+		return transporter.Message{}, err
+	}
+	m, err := newMessage(&c.workspace, channelID, info.name, user, bot, &msg.Msg)
+	if err != nil {
+		return transporter.Message{}, err
+	}
+	m.ConversationType = info.typ
+	return m, nil
+}
+
+// newMessage converts Slack message msg into transporter.Message.
+//
+// It is shared by live events, history and thread backfilling and archive import,
+// so the same message gets the same fields regardless of the way it was collected.
+// user may be nil if the author is unknown, bot is nil for messages posted not by bots.
+func newMessage(ws *workspace, channelID, channelName string, user *slack.User, bot *slack.Bot, msg *slack.Msg) (transporter.Message, error) {
+	ts, err := parseTimestamp(msg.Timestamp)
+	if err != nil {
+		return transporter.Message{}, &permanentError{fmt.Errorf("fail to parse timestamp:%q: %s", msg.Timestamp, err)}
+	}
+	// Slack sets thread_ts only for thread replies and for thread roots with replies,
+	// so standalone messages are treated as roots of their own threads
+	threadTS := msg.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = msg.Timestamp
+	}
+	m := transporter.Message{
+		ThreadID:        generateMessageID(threadTS),
+		Type:            msg.Type,
+		SubType:         msg.SubType,
+		User:            msg.User,
+		Text:            msg.Text,
+		ThreadTimeStamp: threadTS,
+		TimeStamp:       ts.Format(time.RFC3339Nano),
+		MessageTS:       msg.Timestamp,
+		Permalink:       permalink(ws.url, channelID, msg.Timestamp, threadTS),
+		ChannelID:       channelID,
+		ChannelName:     channelName,
+		TeamID:          ws.teamID,
+		TeamName:        ws.teamName,
+		UserID:          msg.User,
+		ParentUserID:    msg.ParentUserId,
+		ReplyCount:      msg.ReplyCount,
+		IsThreadRoot:    threadTS == msg.Timestamp,
+		BotID:           msg.BotID,
+		IsBot:           isBotMessage(msg),
+	}
+	if msg.Edited != nil {
+		m.EditedTS = msg.Edited.Timestamp
+	}
+	if user != nil {
+		m.UserID = user.ID
+		m.DisplayName = user.Profile.DisplayName
+		m.DisplayNameNormalized = user.Profile.DisplayNameNormalized
+		m.UserTeam = user.TeamID
+		m.IsExternal = isExternal(user, ws.teamID)
+		m.IsBot = m.IsBot || user.IsBot
+	}
+	if bot != nil {
+		m.AppID = bot.AppID
+	}
+	if user == nil && m.IsBot {
+		// integrations and workflows may override the bot name via username
+		name := msg.Username
+		if name == "" && bot != nil {
+			name = bot.Name
+		}
+		m.DisplayName = name
+		m.DisplayNameNormalized = name
+	}
+	return m, nil
+}
+
+// messageEvent represents the raw message event
+type messageEvent struct {
+	userMessage
+	SubMessage *userMessage `json:"message,omitempty"`
+}
+
+// parseMessageEvent returns the message from message event.
+//
+// slackevents.MessageEvent lacks thread fields such as reply_count and parent_user_id
+// and the author details such as user_profile, so the message is parsed from the raw event.
+// The edited message is returned for message_changed events.
+func parseMessageEvent(event slackevents.EventsAPIEvent) (*userMessage, error) {
+	cb, ok := event.Data.(*slackevents.EventsAPICallbackEvent)
+	if !ok || cb.InnerEvent == nil {
+		return nil, fmt.Errorf("missing raw event data")
+	}
+	var ev messageEvent
+	if err := json.Unmarshal(*cb.InnerEvent, &ev); err != nil {
+		return nil, fmt.Errorf("cannot parse message event: %w", err)
+	}
+	if ev.SubType != slack.MsgSubTypeMessageChanged {
+		return &ev.userMessage, nil
+	}
+	if ev.SubMessage == nil {
+		return nil, fmt.Errorf("missing message in %s event", ev.SubType)
+	}
+	msg := *ev.SubMessage
+	msg.Channel = ev.Channel
+	if msg.Type == "" {
+		msg.Type = ev.Type
+	}
+	return &msg, nil
+}
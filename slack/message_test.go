@@ -0,0 +1,160 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"slack2logs/transporter"
+)
+
+// Test for messages built from live events and from backfilled history and threads
+func TestNewMessageLiveAndBackfill(t *testing.T) {
+	ws := &workspace{teamID: "T1", teamName: "Team", url: "https://example.slack.com/"}
+	users := map[string]*slack.User{
+		"U2": {ID: "U2", Profile: slack.UserProfile{DisplayName: "bob", DisplayNameNormalized: "bob"}},
+	}
+
+	liveMessage := func(t *testing.T, event string) transporter.Message {
+		t.Helper()
+		data := `{"type":"event_callback","team_id":"T1","event":` + event + `}`
+		ev, err := slackevents.ParseEvent(json.RawMessage(data), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			t.Fatalf("cannot parse event: %s", err)
+		}
+		msg, err := parseMessageEvent(ev)
+		if err != nil {
+			t.Fatalf("cannot parse message event: %s", err)
+		}
+		m, err := newMessage(ws, "C1", "general", users[msg.User], botFromProfile(&msg.Msg), &msg.Msg)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return m
+	}
+	backfillMessage := func(t *testing.T, message string) transporter.Message {
+		t.Helper()
+		var msg slack.Message
+		if err := json.Unmarshal([]byte(message), &msg); err != nil {
+			t.Fatalf("cannot parse message: %s", err)
+		}
+		m, err := newMessage(ws, "C1", "general", users[msg.User], botFromProfile(&msg.Msg), &msg.Msg)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name string
+		// live is a message event received via Socket Mode or Events API
+		live string
+		// backfill is a message returned by conversations.history or conversations.replies
+		backfill string
+		want     transporter.Message
+	}{
+		{
+			name:     "standalone message",
+			live:     `{"type":"message","channel":"C1","user":"U2","text":"hello","ts":"1705399200.000100","event_ts":"1705399200.000100"}`,
+			backfill: `{"type":"message","user":"U2","text":"hello","ts":"1705399200.000100"}`,
+			want: transporter.Message{
+				ThreadID: generateMessageID("1705399200.000100"), Type: "message", User: "U2", Text: "hello",
+				ThreadTimeStamp: "1705399200.000100", TimeStamp: "2024-01-16T10:00:00.0001Z", MessageTS: "1705399200.000100",
+				Permalink: "https://example.slack.com/archives/C1/p1705399200000100", ChannelID: "C1", ChannelName: "general",
+				TeamID: "T1", TeamName: "Team", UserID: "U2", DisplayName: "bob", DisplayNameNormalized: "bob", IsThreadRoot: true,
+			},
+		},
+		{
+			name: "thread reply",
+			live: `{"type":"message","channel":"C1","user":"U2","text":"reply","ts":"1705399260.000200",` +
+				`"thread_ts":"1705399200.000100","parent_user_id":"U1","event_ts":"1705399260.000200"}`,
+			backfill: `{"type":"message","user":"U2","text":"reply","ts":"1705399260.000200","thread_ts":"1705399200.000100","parent_user_id":"U1"}`,
+			want: transporter.Message{
+				ThreadID: generateMessageID("1705399200.000100"), Type: "message", User: "U2", Text: "reply",
+				ThreadTimeStamp: "1705399200.000100", TimeStamp: "2024-01-16T10:01:00.0002Z", MessageTS: "1705399260.000200",
+				Permalink: "https://example.slack.com/archives/C1/p1705399260000200?cid=C1&thread_ts=1705399200.000100",
+				ChannelID: "C1", ChannelName: "general", TeamID: "T1", TeamName: "Team",
+				UserID: "U2", DisplayName: "bob", DisplayNameNormalized: "bob", ParentUserID: "U1",
+			},
+		},
+		{
+			name: "edited thread reply",
+			live: `{"type":"message","subtype":"message_changed","channel":"C1","ts":"1705399320.000300","event_ts":"1705399320.000300",` +
+				`"message":{"type":"message","user":"U2","text":"fixed reply","ts":"1705399260.000200","thread_ts":"1705399200.000100",` +
+				`"parent_user_id":"U1","edited":{"user":"U2","ts":"1705399320.000000"}},` +
+				`"previous_message":{"type":"message","user":"U2","text":"reply","ts":"1705399260.000200","thread_ts":"1705399200.000100"}}`,
+			backfill: `{"type":"message","user":"U2","text":"fixed reply","ts":"1705399260.000200","thread_ts":"1705399200.000100",` +
+				`"parent_user_id":"U1","edited":{"user":"U2","ts":"1705399320.000000"}}`,
+			want: transporter.Message{
+				ThreadID: generateMessageID("1705399200.000100"), Type: "message", User: "U2", Text: "fixed reply",
+				ThreadTimeStamp: "1705399200.000100", TimeStamp: "2024-01-16T10:01:00.0002Z", MessageTS: "1705399260.000200", EditedTS: "1705399320.000000",
+				Permalink: "https://example.slack.com/archives/C1/p1705399260000200?cid=C1&thread_ts=1705399200.000100",
+				ChannelID: "C1", ChannelName: "general", TeamID: "T1", TeamName: "Team",
+				UserID: "U2", DisplayName: "bob", DisplayNameNormalized: "bob", ParentUserID: "U1",
+			},
+		},
+		{
+			name: "thread root with replies",
+			live: `{"type":"message","subtype":"message_changed","channel":"C1","ts":"1705399260.000300","event_ts":"1705399260.000300",` +
+				`"message":{"type":"message","user":"U2","text":"question","ts":"1705399200.000100","thread_ts":"1705399200.000100","reply_count":1}}`,
+			backfill: `{"type":"message","user":"U2","text":"question","ts":"1705399200.000100","thread_ts":"1705399200.000100","reply_count":1}`,
+			want: transporter.Message{
+				ThreadID: generateMessageID("1705399200.000100"), Type: "message", User: "U2", Text: "question",
+				ThreadTimeStamp: "1705399200.000100", TimeStamp: "2024-01-16T10:00:00.0001Z", MessageTS: "1705399200.000100",
+				Permalink: "https://example.slack.com/archives/C1/p1705399200000100", ChannelID: "C1", ChannelName: "general",
+				TeamID: "T1", TeamName: "Team", UserID: "U2", DisplayName: "bob", DisplayNameNormalized: "bob",
+				ReplyCount: 1, IsThreadRoot: true,
+			},
+		},
+		{
+			name: "incoming webhook message",
+			live: `{"type":"message","subtype":"bot_message","channel":"C1","text":"alert firing","ts":"1705399200.000100",` +
+				`"bot_id":"B1","username":"alertmanager","bot_profile":{"id":"B1","app_id":"A1","name":"incoming-webhook"},"event_ts":"1705399200.000100"}`,
+			backfill: `{"type":"message","subtype":"bot_message","text":"alert firing","ts":"1705399200.000100",` +
+				`"bot_id":"B1","username":"alertmanager","bot_profile":{"id":"B1","app_id":"A1","name":"incoming-webhook"}}`,
+			want: transporter.Message{
+				ThreadID: generateMessageID("1705399200.000100"), Type: "message", SubType: "bot_message", Text: "alert firing",
+				ThreadTimeStamp: "1705399200.000100", TimeStamp: "2024-01-16T10:00:00.0001Z", MessageTS: "1705399200.000100",
+				Permalink: "https://example.slack.com/archives/C1/p1705399200000100", ChannelID: "C1", ChannelName: "general",
+				TeamID: "T1", TeamName: "Team", DisplayName: "alertmanager", DisplayNameNormalized: "alertmanager",
+				IsThreadRoot: true, BotID: "B1", AppID: "A1", IsBot: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := liveMessage(t, tt.live)
+			backfill := backfillMessage(t, tt.backfill)
+			if live != backfill {
+				t.Fatalf("live and backfilled messages differ;\nlive\n%+v\nbackfill\n%+v", live, backfill)
+			}
+			if live != tt.want {
+				t.Fatalf("unexpected message;\ngot\n%+v\nwant\n%+v", live, tt.want)
+			}
+		})
+	}
+}
+
+// Test for parsing author details of external users from message events
+func TestParseMessageEventUserProfile(t *testing.T) {
+	f := func(event string) {
+		t.Helper()
+		data := `{"type":"event_callback","team_id":"T1","event":` + event + `}`
+		ev, err := slackevents.ParseEvent(json.RawMessage(data), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			t.Fatalf("cannot parse event: %s", err)
+		}
+		msg, err := parseMessageEvent(ev)
+		if err != nil {
+			t.Fatalf("cannot parse message event: %s", err)
+		}
+		if msg.User != "U2" || msg.UserTeam != "T2" || msg.UserProfile == nil || msg.UserProfile.DisplayName != "bob" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	}
+	f(`{"type":"message","channel":"C1","user":"U2","user_team":"T2","user_profile":{"display_name":"bob","team":"T2"},"text":"hi","ts":"1705399200.000100"}`)
+	f(`{"type":"message","subtype":"message_changed","channel":"C1","ts":"1705399300.000100",` +
+		`"message":{"type":"message","user":"U2","user_team":"T2","user_profile":{"display_name":"bob"},"text":"hi!","ts":"1705399200.000100"}}`)
+}
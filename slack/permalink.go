@@ -0,0 +1,26 @@
+package slack
+
+import (
+	"net/url"
+	"strings"
+)
+
+// permalink returns link to the message with the given ts in the channel.
+// Links to thread replies contain thread_ts and cid query args, so Slack opens them in the thread view.
+// It returns empty string if workspaceURL is unknown.
+//
+// The link is built locally in the same format as chat.getPermalink returns,
+// so there is no need to call the API for every message.
+func permalink(workspaceURL, channelID, ts, threadTS string) string {
+	if workspaceURL == "" || ts == "" {
+		return ""
+	}
+	link := strings.TrimSuffix(workspaceURL, "/") + "/archives/" + channelID + "/p" + strings.Replace(ts, ".", "", 1)
+	if threadTS != "" && threadTS != ts {
+		q := url.Values{}
+		q.Set("thread_ts", threadTS)
+		q.Set("cid", channelID)
+		link += "?" + q.Encode()
+	}
+	return link
+}
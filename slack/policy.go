@@ -0,0 +1,183 @@
+package slack
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	optOutUsersFile       = flag.String("slack.policy.optOutUsersFile", "", "Path to the file with Slack user ids whose messages must never be exported. One id per line, lines starting with # are ignored. The file is re-read on SIGHUP and when its contents change")
+	legalHoldChannelsFile = flag.String("slack.policy.legalHoldChannelsFile", "", "Path to the file with Slack channel ids under legal hold. Messages from these channels are always exported, even if other filters or the opt-out list would drop them. One id per line, lines starting with # are ignored. The file is re-read on SIGHUP and when its contents change")
+	policyCheckInterval   = flag.Duration("slack.policy.checkInterval", 10*time.Second, "Interval for checking policy files for changes. See -slack.policy.optOutUsersFile and -slack.policy.legalHoldChannelsFile")
+)
+
+var (
+	optOutDroppedCount   = metrics.GetOrCreateCounter(`vm_slack2logs_messages_dropped_total{source="slack",reason="opt_out"}`)
+	legalHoldExportCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_legal_hold_total{source="slack"}`)
+	policyReloadsCount   = metrics.GetOrCreateCounter(`vm_slack2logs_policy_reloads_total`)
+	policyReloadErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_policy_reload_errors_total`)
+)
+
+var (
+	globalPolicy   policy
+	initPolicyOnce sync.Once
+)
+
+// mustInitPolicy loads policy files and starts watching them for changes.
+// It is safe to call it multiple times.
+func mustInitPolicy() {
+	initPolicyOnce.Do(func() {
+		if err := globalPolicy.reload(); err != nil {
+			log.Fatalf("cannot load slack policy files: %s", err)
+		}
+		if *optOutUsersFile == "" && *legalHoldChannelsFile == "" {
+			return
+		}
+		go globalPolicy.watch()
+	})
+}
+
+// policy holds lists of users and channels which override
+// the usual message filtering rules.
+type policy struct {
+	optOutUsers       atomic.Pointer[idSet]
+	legalHoldChannels atomic.Pointer[idSet]
+
+	// raw contents of the policy files, used for detecting changes.
+	// They are accessed only by reload.
+	optOutUsersData       []byte
+	legalHoldChannelsData []byte
+}
+
+type idSet map[string]struct{}
+
+// allow reports whether the message posted by userID in channelID can be exported.
+// filtered must be set to true if the message is dropped by any other filter.
+//
+// Legal hold has priority over both other filters and the opt-out list.
+func (p *policy) allow(channelID, userID string, filtered bool) bool {
+	if p.isLegalHold(channelID) {
+		if filtered || p.isOptedOut(userID) {
+			legalHoldExportCount.Inc()
+		}
+		return true
+	}
+	if filtered {
+		return false
+	}
+	if p.isOptedOut(userID) {
+		optOutDroppedCount.Inc()
+		return false
+	}
+	return true
+}
+
+// allowed is like allow, but it doesn't update metrics. It is used for counting exported messages
+func (p *policy) allowed(channelID, userID string, filtered bool) bool {
+	if p.isLegalHold(channelID) {
+		return true
+	}
+	return !filtered && !p.isOptedOut(userID)
+}
+
+func (p *policy) isOptedOut(userID string) bool {
+	return p.optOutUsers.Load().contains(userID)
+}
+
+func (p *policy) isLegalHold(channelID string) bool {
+	return p.legalHoldChannels.Load().contains(channelID)
+}
+
+func (s *idSet) contains(id string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := (*s)[id]
+	return ok
+}
+
+// watch reloads policy files on SIGHUP and on every -slack.policy.checkInterval
+// if their contents were changed.
+func (p *policy) watch() {
+	sighupC := make(chan os.Signal, 1)
+	signal.Notify(sighupC, syscall.SIGHUP)
+	ticker := time.NewTicker(*policyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sighupC:
+			log.Printf("SIGHUP received; reloading slack policy files")
+		case <-ticker.C:
+		}
+		if err := p.reload(); err != nil {
+			log.Printf("error reload slack policy files, continue using the previous lists: %s", err)
+			policyReloadErrors.Inc()
+		}
+	}
+}
+
+// reload re-reads policy files and updates lists if files were changed.
+func (p *policy) reload() error {
+	optOutData, err := readPolicyFile(*optOutUsersFile)
+	if err != nil {
+		return err
+	}
+	legalHoldData, err := readPolicyFile(*legalHoldChannelsFile)
+	if err != nil {
+		return err
+	}
+	changed := false
+	if p.optOutUsers.Load() == nil || !bytes.Equal(optOutData, p.optOutUsersData) {
+		users := parseIDs(optOutData)
+		p.optOutUsers.Store(&users)
+		p.optOutUsersData = optOutData
+		changed = true
+	}
+	if p.legalHoldChannels.Load() == nil || !bytes.Equal(legalHoldData, p.legalHoldChannelsData) {
+		channels := parseIDs(legalHoldData)
+		p.legalHoldChannels.Store(&channels)
+		p.legalHoldChannelsData = legalHoldData
+		changed = true
+	}
+	if changed {
+		log.Printf("loaded slack policy: %d opted-out users, %d channels under legal hold", len(*p.optOutUsers.Load()), len(*p.legalHoldChannels.Load()))
+		policyReloadsCount.Inc()
+	}
+	return nil
+}
+
+func readPolicyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file %q: %w", path, err)
+	}
+	return data, nil
+}
+
+// parseIDs parses ids from data. Every line must contain a single id.
+// Empty lines and lines starting with # are ignored.
+func parseIDs(data []byte) idSet {
+	ids := make(idSet)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids[line] = struct{}{}
+	}
+	return ids
+}
@@ -0,0 +1,75 @@
+package slack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test for parseIDs function
+func TestParseIDs(t *testing.T) {
+	data := []byte("# opted out users\nU01\n\n  U02  \r\n#U03\n")
+	ids := parseIDs(data)
+	if len(ids) != 2 {
+		t.Fatalf("unexpected number of ids; got %d; want 2", len(ids))
+	}
+	for _, id := range []string{"U01", "U02"} {
+		if !ids.contains(id) {
+			t.Errorf("expecting id %q to be parsed", id)
+		}
+	}
+}
+
+// Test for policy.allow method
+func TestPolicyAllow(t *testing.T) {
+	var p policy
+	optOut := idSet{"U_OPT_OUT": {}}
+	legalHold := idSet{"C_HOLD": {}}
+	p.optOutUsers.Store(&optOut)
+	p.legalHoldChannels.Store(&legalHold)
+
+	tests := []struct {
+		channelID string
+		userID    string
+		filtered  bool
+		want      bool
+	}{
+		{"C1", "U1", false, true},
+		{"C1", "U1", true, false},
+		{"C1", "U_OPT_OUT", false, false},
+		{"C_HOLD", "U1", true, true},
+		{"C_HOLD", "U_OPT_OUT", false, true},
+	}
+	for _, tt := range tests {
+		if got := p.allow(tt.channelID, tt.userID, tt.filtered); got != tt.want {
+			t.Errorf("allow(%q, %q, %v) = %v, want %v", tt.channelID, tt.userID, tt.filtered, got, tt.want)
+		}
+	}
+}
+
+// Test for policy.reload method
+func TestPolicyReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opt-out.txt")
+	if err := os.WriteFile(path, []byte("U1\n"), 0o644); err != nil {
+		t.Fatalf("cannot write policy file: %s", err)
+	}
+	defer func(v string) { *optOutUsersFile = v }(*optOutUsersFile)
+	*optOutUsersFile = path
+
+	var p policy
+	if err := p.reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !p.isOptedOut("U1") || p.isOptedOut("U2") {
+		t.Fatalf("unexpected opt-out list after the first load")
+	}
+	if err := os.WriteFile(path, []byte("U2\n"), 0o644); err != nil {
+		t.Fatalf("cannot write policy file: %s", err)
+	}
+	if err := p.reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.isOptedOut("U1") || !p.isOptedOut("U2") {
+		t.Fatalf("unexpected opt-out list after reload")
+	}
+}
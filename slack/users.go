@@ -0,0 +1,62 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/slack-go/slack"
+)
+
+// userMessage is Slack message with the author details,
+// which Slack embeds into message events and export archives, while slack.Msg lacks them
+type userMessage struct {
+	slack.Msg
+	// UserTeam is the team of the author. It differs from the workspace team for external users in shared channels
+	UserTeam    string             `json:"user_team,omitempty"`
+	UserProfile *slack.UserProfile `json:"user_profile,omitempty"`
+}
+
+// getUser returns the user with the given id from the given team.
+//
+// users.info fails or returns partial profiles for external users in Slack Connect channels,
+// so the profile embedded into the message is used for them if it is present.
+// If an external user cannot be obtained at all, the user with only id and team is returned.
+func (c *Client) getUser(ctx context.Context, userID, userTeam string, profile *slack.UserProfile) (*slack.User, error) {
+	external := userTeam != "" && userTeam != c.teamID
+	if external && profile != nil {
+		return embeddedUser(userID, userTeam, profile), nil
+	}
+	u, err := c.api.GetUserInfoContext(ctx, userID)
+	if err == nil {
+		if u.TeamID == "" {
+			u.TeamID = userTeam
+		}
+		return u, nil
+	}
+	if profile != nil {
+		return embeddedUser(userID, userTeam, profile), nil
+	}
+	if external {
+		log.Printf("%scannot get external user %q from team %q: %s", c.logPrefix(), userID, userTeam, err)
+		return &slack.User{ID: userID, TeamID: userTeam}, nil
+	}
+	return nil, fmt.Errorf("error get user %q: %w", userID, err)
+}
+
+// embeddedUser returns user for the profile embedded into the message
+func embeddedUser(userID, userTeam string, profile *slack.UserProfile) *slack.User {
+	if userTeam == "" {
+		userTeam = profile.Team
+	}
+	return &slack.User{
+		ID:      userID,
+		TeamID:  userTeam,
+		Profile: *profile,
+	}
+}
+
+// isExternal reports whether the user belongs to another organization than the workspace with the given team id
+func isExternal(user *slack.User, teamID string) bool {
+	return user.TeamID != "" && teamID != "" && user.TeamID != teamID
+}
@@ -0,0 +1,65 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// Test for Client.getUser method
+func TestGetUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse users.info request: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("user") {
+		case "U1":
+			_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1","team_id":"T1","profile":{"display_name":"alice"}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok":false,"error":"user_not_found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		api:       slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		workspace: workspace{teamID: "T1"},
+	}
+	ctx := context.Background()
+
+	// internal user is obtained via users.info
+	u, err := c.getUser(ctx, "U1", "T1", &slack.UserProfile{DisplayName: "partial"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.Profile.DisplayName != "alice" || isExternal(u, c.teamID) {
+		t.Fatalf("unexpected internal user: %+v", u)
+	}
+
+	// external user is obtained from the embedded profile
+	u, err = c.getUser(ctx, "U2", "T2", &slack.UserProfile{DisplayName: "bob"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.ID != "U2" || u.TeamID != "T2" || u.Profile.DisplayName != "bob" || !isExternal(u, c.teamID) {
+		t.Fatalf("unexpected external user: %+v", u)
+	}
+
+	// unknown external user isn't dropped
+	u, err = c.getUser(ctx, "U3", "T3", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.ID != "U3" || u.TeamID != "T3" {
+		t.Fatalf("unexpected external user: %+v", u)
+	}
+
+	// unknown internal user is an error
+	if _, err := c.getUser(ctx, "U4", "T1", nil); err == nil {
+		t.Fatalf("expecting non-nil error for unknown user")
+	}
+}
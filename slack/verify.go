@@ -0,0 +1,91 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"slack2logs/transporter"
+)
+
+// TeamID returns the id of the workspace the client is connected to
+func (c *Client) TeamID() string {
+	return c.teamID
+}
+
+// Channels returns sorted ids of the listened channels
+func (c *Client) Channels() []string {
+	channels := make([]string, 0, len(c.listeningChannels))
+	for channelID := range c.listeningChannels {
+		channels = append(channels, channelID)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// CountMessages returns the number of exported messages from channelID posted in [start, end) per UTC day.
+//
+// Only thread roots and standalone messages are counted, since conversations.history doesn't return thread replies.
+// System messages stored as channel events aren't counted as well.
+func (c *Client) CountMessages(ctx context.Context, channelID string, start, end time.Time) (map[time.Time]int, error) {
+	counts := make(map[time.Time]int)
+	err := c.forEachHistoryMessage(ctx, channelID, slackTimestamp(start), slackTimestamp(end), func(msg *slack.Msg) error {
+		if !isCounted(channelID, msg) {
+			return nil
+		}
+		t, err := parseTimestamp(msg.Timestamp)
+		if err != nil {
+			return nil
+		}
+		counts[t.Truncate(24*time.Hour)]++
+		return nil
+	})
+	return counts, err
+}
+
+// isCounted reports whether msg is exported as a message and is counted by CountMessages
+func isCounted(channelID string, msg *slack.Msg) bool {
+	if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+		return false
+	}
+	if _, ok := systemEventFromMessage(channelID, msg); ok {
+		return false
+	}
+	if msg.User == "" && msg.BotID == "" {
+		return false
+	}
+	return globalPolicy.allowed(channelID, msg.User, isFiltered(channelID, msg))
+}
+
+// CollectMessages passes messages from channelID posted in [start, end) and all the replies to them to cb.
+// Messages are filtered in the same way as live messages.
+func (c *Client) CollectMessages(ctx context.Context, channelID string, start, end time.Time, cb func(m transporter.Message)) error {
+	convert := func(msg *slack.Msg) error {
+		m, ok, err := c.convertHistoryMessage(ctx, channelID, msg)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Printf("%serror build message from channel %q: %s", c.logPrefix(), channelID, err)
+			handleMessageErrors.Inc()
+			return nil
+		}
+		if ok {
+			cb(m)
+		}
+		return nil
+	}
+	return c.forEachHistoryMessage(ctx, channelID, slackTimestamp(start), slackTimestamp(end), func(msg *slack.Msg) error {
+		if err := convert(msg); err != nil {
+			return err
+		}
+		if msg.ReplyCount == 0 {
+			return nil
+		}
+		return c.forEachReply(ctx, channelID, msg.Timestamp, "", convert)
+	})
+}
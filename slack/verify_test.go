@@ -0,0 +1,37 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// Test for isCounted function
+func TestIsCounted(t *testing.T) {
+	f := func(msg slack.Msg, want bool) {
+		t.Helper()
+		if got := isCounted("C1", &msg); got != want {
+			t.Fatalf("unexpected isCounted for %+v; got %v; want %v", msg, got, want)
+		}
+	}
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", Text: "hello"}, true)
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", ThreadTimestamp: "1705399200.000100", Text: "thread root"}, true)
+	f(slack.Msg{User: "U1", Timestamp: "1705399210.000100", ThreadTimestamp: "1705399200.000100", Text: "reply"}, false)
+
+	origExcludeSubtypes := *excludeSubtypes
+	defer func() { *excludeSubtypes = origExcludeSubtypes }()
+	// system messages pass subtype filters, but they are exported as channel events, so they aren't counted
+	*excludeSubtypes = []string{slack.MsgSubTypeMessageDeleted}
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypeChannelTopic, Topic: "news"}, false)
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypeChannelName, Name: "general"}, false)
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypeChannelArchive}, false)
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypePinnedItem}, false)
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypeChannelJoin}, false)
+
+	// membership messages are counted as regular messages if membership events are disabled and the subtype is exported
+	origMembershipEvents, origIncludeSubtypes := *membershipEvents, *includeSubtypes
+	defer func() { *membershipEvents, *includeSubtypes = origMembershipEvents, origIncludeSubtypes }()
+	*membershipEvents = false
+	*includeSubtypes = []string{slack.MsgSubTypeChannelJoin}
+	f(slack.Msg{User: "U1", Timestamp: "1705399200.000100", SubType: slack.MsgSubTypeChannelJoin}, true)
+}
@@ -0,0 +1,130 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"slack2logs/transporter"
+)
+
+const (
+	// sdID is the structured data id for message fields.
+	// 32473 is the private enterprise number reserved for documentation, see RFC 5612
+	sdID = "slack@32473"
+
+	// timestampLayout is RFC 5424 TIMESTAMP with the maximum allowed precision
+	timestampLayout = "2006-01-02T15:04:05.999999Z07:00"
+
+	nilValue = "-"
+	bom      = "\xef\xbb\xbf"
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var severities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// formatter formats messages as RFC 5424 records.
+// See https://www.rfc-editor.org/rfc/rfc5424
+type formatter struct {
+	priority int
+	hostname string
+	appName  string
+}
+
+func newFormatter(facility, severity, hostname, appName string) (*formatter, error) {
+	f, ok := facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unsupported syslog facility %q", facility)
+	}
+	s, ok := severities[severity]
+	if !ok {
+		return nil, fmt.Errorf("unsupported syslog severity %q", severity)
+	}
+	return &formatter{
+		priority: f*8 + s,
+		hostname: headerValue(hostname, 255),
+		appName:  headerValue(appName, 48),
+	}, nil
+}
+
+// format returns RFC 5424 record for message m:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [slack@32473 name="value" ...] BOM MSG
+func (f *formatter) format(m *transporter.Message) ([]byte, error) {
+	t, err := m.Time()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse message timestamp %q: %w", m.TimeStamp, err)
+	}
+	var b strings.Builder
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(f.priority))
+	b.WriteString(">1 ")
+	b.WriteString(t.UTC().Format(timestampLayout))
+	b.WriteByte(' ')
+	b.WriteString(f.hostname)
+	b.WriteByte(' ')
+	b.WriteString(f.appName)
+	b.WriteString(" - ")
+	b.WriteString(headerValue(m.Type, 32))
+	b.WriteByte(' ')
+	writeStructuredData(&b, m)
+	if m.Text != "" {
+		b.WriteByte(' ')
+		b.WriteString(bom)
+		b.WriteString(m.Text)
+	}
+	return []byte(b.String()), nil
+}
+
+// writeStructuredData writes message fields except text and ts as SD-PARAMs
+func writeStructuredData(b *strings.Builder, m *transporter.Message) {
+	b.WriteByte('[')
+	b.WriteString(sdID)
+	for _, f := range m.Fields() {
+		if f.Name == "text" || f.Name == "ts" {
+			continue
+		}
+		b.WriteByte(' ')
+		b.WriteString(f.Name)
+		b.WriteString(`="`)
+		writeParamValue(b, f.Value)
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+}
+
+// writeParamValue escapes '"', '\' and ']' according to RFC 5424 section 6.3.3
+func writeParamValue(b *strings.Builder, s string) {
+	for _, r := range s {
+		switch r {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+}
+
+// headerValue returns s as a header field value,
+// which must contain only printable US-ASCII characters and be limited to maxLen.
+func headerValue(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	return s
+}
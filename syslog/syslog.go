@@ -0,0 +1,203 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/transporter"
+)
+
+const (
+	networkUDP = "udp"
+	networkTCP = "tcp"
+	networkTLS = "tls"
+)
+
+var (
+	syslogAddr    = flag.String("syslog.addr", "localhost:514", "Syslog server address to send messages to if -output contains syslog")
+	syslogNetwork = flag.String("syslog.network", networkUDP, "Network for sending messages to syslog server. Supported values: udp, tcp, tls. "+
+		"Records are framed with octet counting for tcp and tls, see https://www.rfc-editor.org/rfc/rfc6587#section-3.4.1")
+	syslogFacility              = flag.String("syslog.facility", "local0", "Syslog facility for messages, for example user, auth or local0-local7")
+	syslogSeverity              = flag.String("syslog.severity", "info", "Syslog severity for messages, for example notice or info")
+	syslogHostname              = flag.String("syslog.hostname", "", "HOSTNAME field of syslog records. The hostname of the machine is used if empty")
+	syslogAppName               = flag.String("syslog.appName", "slack2logs", "APP-NAME field of syslog records")
+	syslogTLSCAFile             = flag.String("syslog.tls.caFile", "", "Optional path to CA file for verifying syslog server certificate if -syslog.network=tls. System CA is used if empty")
+	syslogTLSServerName         = flag.String("syslog.tls.serverName", "", "Optional server name for verifying syslog server certificate if -syslog.network=tls")
+	syslogTLSInsecureSkipVerify = flag.Bool("syslog.tls.insecureSkipVerify", false, "Whether to skip verification of syslog server certificate if -syslog.network=tls")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="syslog"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="syslog"}`)
+	reconnectsCount       = metrics.GetOrCreateCounter(`vm_slack2logs_syslog_reconnects_total`)
+)
+
+// dialTimeout is the maximum time for establishing connection to syslog server
+const dialTimeout = 10 * time.Second
+
+// Client sends messages as RFC 5424 records to syslog server.
+// Connection is established on the first message and
+// re-established if writing to it fails.
+type Client struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	formatter *formatter
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// conn is a connection to syslog server
+type conn struct {
+	net.Conn
+	// closedByPeer is set when the server closes stream connection.
+	// Syslog servers don't send data to clients, so the read returns only when the connection is closed.
+	// This allows detecting closed connection before writing the record, which would be lost otherwise.
+	closedByPeer atomic.Bool
+}
+
+func newConn(nc net.Conn, stream bool) *conn {
+	c := &conn{Conn: nc}
+	if stream {
+		go func() {
+			_, _ = io.Copy(io.Discard, nc)
+			c.closedByPeer.Store(true)
+		}()
+	}
+	return c
+}
+
+// New returns Client configured via -syslog.* flags
+func New() (*Client, error) {
+	hostname := *syslogHostname
+	if hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain hostname: %w", err)
+		}
+		hostname = h
+	}
+	f, err := newFormatter(*syslogFacility, *syslogSeverity, hostname, *syslogAppName)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		network:   *syslogNetwork,
+		addr:      *syslogAddr,
+		formatter: f,
+	}
+	switch c.network {
+	case networkUDP, networkTCP:
+	case networkTLS:
+		c.tlsConfig, err = newTLSConfig(*syslogTLSCAFile, *syslogTLSServerName, *syslogTLSInsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported -syslog.network=%q; supported values: %s, %s, %s", c.network, networkUDP, networkTCP, networkTLS)
+	}
+	return c, nil
+}
+
+func newTLSConfig(caFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read -syslog.tls.caFile=%q: %w", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("cannot parse certificates from -syslog.tls.caFile=%q", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// Import sends message to syslog server.
+// If the connection is broken, it reconnects and sends the message again.
+func (c *Client) Import(ctx context.Context, message transporter.Message) error {
+	messagesDeliveryCount.Inc()
+	record, err := c.formatter.format(&message)
+	if err != nil {
+		handleMessageErrors.Inc()
+		return err
+	}
+	if c.network != networkUDP {
+		record = append([]byte(strconv.Itoa(len(record))+" "), record...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(ctx, record); err != nil {
+		log.Printf("cannot send message to syslog server %q: %s; reconnecting", c.addr, err)
+		c.closeConn()
+		reconnectsCount.Inc()
+		if err := c.write(ctx, record); err != nil {
+			c.closeConn()
+			handleMessageErrors.Inc()
+			return fmt.Errorf("cannot send message to syslog server %q: %w", c.addr, err)
+		}
+	}
+	return nil
+}
+
+// Close closes connection to syslog server
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeConn()
+}
+
+func (c *Client) write(ctx context.Context, record []byte) error {
+	if c.conn != nil && c.conn.closedByPeer.Load() {
+		c.closeConn()
+	}
+	if c.conn == nil {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return err
+		}
+		c.conn = newConn(conn, c.network != networkUDP)
+	}
+	_, err := c.conn.Write(record)
+	return err
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	if c.network == networkTLS {
+		d := &tls.Dialer{Config: c.tlsConfig}
+		return d.DialContext(ctx, networkTCP, c.addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, c.network, c.addr)
+}
+
+func (c *Client) closeConn() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
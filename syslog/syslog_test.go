@@ -0,0 +1,130 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+// Test for formatter.format method
+func TestFormat(t *testing.T) {
+	f, err := newFormatter("local0", "info", "host name", "slack2logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m := transporter.Message{
+		Type:        "message",
+		Text:        "hello\nworld",
+		TimeStamp:   "2024-01-16T10:00:00.123456789Z",
+		ChannelID:   "C1",
+		ChannelName: `dev "team"`,
+		UserID:      "U1",
+		DisplayName: `a\b]`,
+	}
+	got, err := f.format(&m)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `<134>1 2024-01-16T10:00:00.123456Z host_name slack2logs - message ` +
+		`[slack@32473 type="message" channel_id="C1" channel_name="dev \"team\"" user_id="U1" display_name="a\\b\]"] ` +
+		"\xef\xbb\xbfhello\nworld"
+	if string(got) != want {
+		t.Fatalf("unexpected record;\ngot\n%q\nwant\n%q", got, want)
+	}
+
+	if _, err := newFormatter("unknown", "info", "host", "app"); err == nil {
+		t.Fatalf("expecting non-nil error for unknown facility")
+	}
+}
+
+// Test for Client over TCP with octet counting and reconnects
+func TestClientTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer ln.Close()
+
+	// the server reads a single record per connection and closes it
+	recordsC := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			br := bufio.NewReader(conn)
+			n, err := br.ReadString(' ')
+			if err == nil {
+				size, _ := strconv.Atoi(strings.TrimSpace(n))
+				buf := make([]byte, size)
+				if _, err := br.Read(buf); err == nil {
+					recordsC <- string(buf)
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	f, err := newFormatter("user", "notice", "host", "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &Client{network: networkTCP, addr: ln.Addr().String(), formatter: f}
+	defer c.Close()
+	for _, text := range []string{"first", "second"} {
+		m := transporter.Message{Text: text, TimeStamp: "2024-01-16T10:00:00Z"}
+		if err := c.Import(context.Background(), m); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		select {
+		case r := <-recordsC:
+			if !strings.HasSuffix(r, text) {
+				t.Fatalf("unexpected record %q; want suffix %q", r, text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for record %q", text)
+		}
+		// wait until the client notices closed connection
+		deadline := time.Now().Add(5 * time.Second)
+		for !c.conn.closedByPeer.Load() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// Test for Client over UDP
+func TestClientUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer pc.Close()
+
+	f, err := newFormatter("user", "notice", "host", "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &Client{network: networkUDP, addr: pc.LocalAddr().String(), formatter: f}
+	defer c.Close()
+	m := transporter.Message{Text: "hello", TimeStamp: "2024-01-16T10:00:00Z"}
+	if err := c.Import(context.Background(), m); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buf := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("cannot read record: %s", err)
+	}
+	want := "<13>1 2024-01-16T10:00:00Z host app - - [slack@32473] \xef\xbb\xbfhello"
+	if string(buf[:n]) != want {
+		t.Fatalf("unexpected record; got %q; want %q", buf[:n], want)
+	}
+}
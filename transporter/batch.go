@@ -0,0 +1,235 @@
+package transporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// maxPendingBatches limits the number of full batches kept in memory while flushes fail.
+	// The oldest messages are dropped when the limit is exceeded.
+	maxPendingBatches = 100
+
+	minFlushRetryDelay = time.Second
+	maxFlushRetryDelay = time.Minute
+)
+
+var (
+	batchFlushRetriesCount = metrics.GetOrCreateCounter(`vm_slack2logs_batch_flush_retries_total`)
+	batchOverflowDropped   = metrics.GetOrCreateCounter(`vm_slack2logs_messages_dropped_total{source="batcher",reason="overflow"}`)
+)
+
+// PermanentError is returned from the flush func of Batcher if retrying the flush cannot help,
+// for example, if the destination rejects the messages. Such batches are dropped.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err into PermanentError. It returns nil if err is nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// PartialError is returned from the flush func of Batcher if only some of the messages were sent.
+// Messages, which weren't sent, are kept for the next flush in the original order, while the rest are delivered.
+type PartialError struct {
+	// Failed contains indexes of messages in the flushed batch, which weren't sent
+	Failed []int
+	Err    error
+}
+
+func (e *PartialError) Error() string { return e.Err.Error() }
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// Batcher collects messages into batches and flushes them via flush func
+// when the batch is full or when flushInterval passes since the last flush.
+//
+// Messages of failed flushes are kept and flushed again with exponential backoff,
+// so transient failures of the destination don't lose messages.
+// Batches failed with PermanentError are dropped. Only failed messages are kept if the flush returns PartialError.
+//
+// It is used by importers which send messages in bulk.
+type Batcher struct {
+	maxSize       int
+	flushInterval time.Duration
+	flush         func(ctx context.Context, messages []Message) error
+
+	mu    sync.Mutex
+	batch []Message
+	// onDelivered contains funcs registered via OnDelivered
+	onDelivered []func(messages []Message)
+	// retryDelay is the delay before the next flush after the failed one. It is zero if the last flush succeeded
+	retryDelay time.Duration
+	nextRetry  time.Time
+	stopC      chan struct{}
+	stopped    sync.WaitGroup
+}
+
+// NewBatcher returns Batcher and starts background flushing every flushInterval
+func NewBatcher(maxSize int, flushInterval time.Duration, flush func(ctx context.Context, messages []Message) error) *Batcher {
+	if maxSize <= 0 {
+		maxSize = 1
+	}
+	b := &Batcher{
+		maxSize:       maxSize,
+		flushInterval: flushInterval,
+		flush:         flush,
+		stopC:         make(chan struct{}),
+	}
+	b.stopped.Add(1)
+	go func() {
+		defer b.stopped.Done()
+		for {
+			t := time.NewTimer(b.nextFlushDelay())
+			select {
+			case <-b.stopC:
+				t.Stop()
+				return
+			case <-t.C:
+				if err := b.Flush(context.Background()); err != nil {
+					log.Printf("error flush batch of messages: %s", err)
+				}
+			}
+		}
+	}()
+	return b
+}
+
+// nextFlushDelay returns the delay before the next background flush
+func (b *Batcher) nextFlushDelay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.retryDelay == 0 {
+		return b.flushInterval
+	}
+	return max(time.Until(b.nextRetry), 0)
+}
+
+// OnDelivered registers f, which is called with messages after they are flushed successfully.
+// It implements DeliveryNotifier.
+func (b *Batcher) OnDelivered(f func(messages []Message)) {
+	b.mu.Lock()
+	b.onDelivered = append(b.onDelivered, f)
+	b.mu.Unlock()
+}
+
+// Add adds message to the batch. The batch is flushed synchronously if it is full.
+//
+// Flush errors are only logged, since messages are kept for flushing later.
+// Full batches aren't flushed until the backoff after the failed flush passes.
+func (b *Batcher) Add(ctx context.Context, message Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batch = append(b.batch, message)
+	if len(b.batch) >= b.maxSize && !time.Now().Before(b.nextRetry) {
+		if err := b.flushLocked(ctx); err != nil {
+			log.Printf("error flush batch of messages, it will be retried in %s: %s", b.retryDelay, err)
+		}
+	}
+	b.dropOverflowLocked()
+	return nil
+}
+
+// Flush sends all the collected messages.
+// Messages, which cannot be sent, are kept for the next flush.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(ctx)
+}
+
+// flushLocked sends collected messages in batches of up to maxSize messages.
+// Messages starting from the failed batch are kept unless the batch failed with PermanentError.
+func (b *Batcher) flushLocked(ctx context.Context) error {
+	var permanentErrs []error
+	for len(b.batch) > 0 {
+		n := min(len(b.batch), b.maxSize)
+		if err := b.flush(ctx, b.batch[:n:n]); err != nil {
+			var pe *PermanentError
+			if errors.As(err, &pe) {
+				log.Printf("drop batch of %d messages, since it cannot be sent: %s", n, err)
+				permanentErrs = append(permanentErrs, err)
+				b.batch = b.batch[n:]
+				continue
+			}
+			var partial *PartialError
+			if errors.As(err, &partial) {
+				b.keepFailedLocked(n, partial.Failed)
+			}
+			if b.retryDelay > 0 {
+				batchFlushRetriesCount.Inc()
+			}
+			b.retryDelay = min(max(2*b.retryDelay, minFlushRetryDelay), maxFlushRetryDelay)
+			b.nextRetry = time.Now().Add(b.retryDelay)
+			return errors.Join(append(permanentErrs, err)...)
+		}
+		for _, f := range b.onDelivered {
+			f(b.batch[:n:n])
+		}
+		b.batch = b.batch[n:]
+		b.retryDelay = 0
+		b.nextRetry = time.Time{}
+	}
+	b.batch = nil
+	return errors.Join(permanentErrs...)
+}
+
+// keepFailedLocked notifies about delivery of the first n messages except the failed ones
+// and removes the delivered messages from the batch
+func (b *Batcher) keepFailedLocked(n int, failed []int) {
+	isFailed := make([]bool, n)
+	for _, i := range failed {
+		if i >= 0 && i < n {
+			isFailed[i] = true
+		}
+	}
+	var delivered, kept []Message
+	for i := 0; i < n; i++ {
+		if isFailed[i] {
+			kept = append(kept, b.batch[i])
+		} else {
+			delivered = append(delivered, b.batch[i])
+		}
+	}
+	if len(delivered) > 0 {
+		for _, f := range b.onDelivered {
+			f(delivered)
+		}
+	}
+	b.batch = append(kept, b.batch[n:]...)
+}
+
+// dropOverflowLocked drops the oldest messages if the number of pending messages exceeds the limit
+func (b *Batcher) dropOverflowLocked() {
+	n := len(b.batch) - maxPendingBatches*b.maxSize
+	if n <= 0 {
+		return
+	}
+	log.Printf("drop %d oldest messages, since the destination is unavailable for too long", n)
+	batchOverflowDropped.Add(n)
+	b.batch = append(b.batch[:0:0], b.batch[n:]...)
+}
+
+// Close stops background flushing and flushes the remaining messages
+func (b *Batcher) Close() error {
+	close(b.stopC)
+	b.stopped.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.flushLocked(context.Background()); err != nil {
+		return fmt.Errorf("cannot flush %d remaining messages: %w", len(b.batch), err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package transporter
+
+import (
+	"sync"
+)
+
+// maxPendingDeliveries limits the number of messages waiting for delivery confirmations.
+// Messages, which are pending for the whole generation, are considered lost, for example,
+// if they were rejected by the destination
+const maxPendingDeliveries = 100000
+
+// DeliveryListener is implemented by exporters, which need to know when their messages are delivered,
+// for example, in order to advance checkpoints only after messages are delivered by all the importers
+type DeliveryListener interface {
+	// Delivered is called with the message after it is delivered by all the importers
+	Delivered(m Message)
+}
+
+// deliveryTracker waits for delivery confirmations of messages passed to the importer
+// and notifies the listener once all of them are received.
+//
+// Every message requires one confirmation when Import returns nil
+// and one per importer implementing DeliveryNotifier.
+type deliveryTracker struct {
+	listener      DeliveryListener
+	confirmations int
+
+	mu sync.Mutex
+	// pending and prevPending are the current and the previous generations of messages
+	// waiting for delivery confirmations per msg_id
+	pending     map[string]*pendingDelivery
+	prevPending map[string]*pendingDelivery
+}
+
+type pendingDelivery struct {
+	message Message
+	// missing is the number of missing delivery confirmations
+	missing int
+}
+
+func newDeliveryTracker(i Importer, listener DeliveryListener) *deliveryTracker {
+	dt := &deliveryTracker{
+		listener: listener,
+		pending:  make(map[string]*pendingDelivery),
+	}
+	dt.confirmations = 1 + OnDelivered(i, dt.confirmDelivered)
+	return dt
+}
+
+// add registers the message before passing it to the importer.
+// Messages without msg_id cannot be tracked, so they are ignored
+func (dt *deliveryTracker) add(m *Message) {
+	if m.MsgID == "" {
+		return
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if pd, ok := dt.pending[m.MsgID]; ok {
+		pd.missing += dt.confirmations
+		return
+	}
+	if len(dt.pending) >= maxPendingDeliveries {
+		dt.prevPending = dt.pending
+		dt.pending = make(map[string]*pendingDelivery)
+	}
+	dt.pending[m.MsgID] = &pendingDelivery{message: *m, missing: dt.confirmations}
+}
+
+// forget removes the message, which failed to be imported
+func (dt *deliveryTracker) forget(m *Message) {
+	dt.mu.Lock()
+	delete(dt.pending, m.MsgID)
+	delete(dt.prevPending, m.MsgID)
+	dt.mu.Unlock()
+}
+
+// confirmDelivered is called by importers implementing DeliveryNotifier after messages are delivered
+func (dt *deliveryTracker) confirmDelivered(messages []Message) {
+	for i := range messages {
+		dt.confirm(messages[i].MsgID)
+	}
+}
+
+// confirm registers delivery confirmation for the message with the given id.
+// The listener is notified when all the required confirmations are received.
+func (dt *deliveryTracker) confirm(id string) {
+	if id == "" {
+		return
+	}
+	dt.mu.Lock()
+	pending := dt.pending
+	pd, ok := pending[id]
+	if !ok {
+		pending = dt.prevPending
+		if pd, ok = pending[id]; !ok {
+			// the message failed to be imported or it was pending for too long
+			dt.mu.Unlock()
+			return
+		}
+	}
+	pd.missing--
+	if pd.missing > 0 {
+		dt.mu.Unlock()
+		return
+	}
+	delete(pending, id)
+	dt.mu.Unlock()
+	dt.listener.Delivered(pd.message)
+}
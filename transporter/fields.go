@@ -0,0 +1,53 @@
+package transporter
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Field represents a single message field
+type Field struct {
+	Name  string
+	Value string
+}
+
+// messageFieldNames contains json names of Message fields in the order of declaration
+var messageFieldNames = func() []string {
+	t := reflect.TypeOf(Message{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names[i] = name
+	}
+	return names
+}()
+
+// Fields returns non-empty message fields with their json names
+// in the order of declaration. Values are converted to strings.
+func (m *Message) Fields() []Field {
+	v := reflect.ValueOf(m).Elem()
+	fields := make([]Field, 0, len(messageFieldNames))
+	for i, name := range messageFieldNames {
+		if name == "" || name == "-" {
+			continue
+		}
+		f := v.Field(i)
+		if f.IsZero() {
+			continue
+		}
+		var value string
+		switch f.Kind() {
+		case reflect.String:
+			value = f.String()
+		case reflect.Bool:
+			value = strconv.FormatBool(f.Bool())
+		case reflect.Int, reflect.Int64:
+			value = strconv.FormatInt(f.Int(), 10)
+		default:
+			continue
+		}
+		fields = append(fields, Field{Name: name, Value: value})
+	}
+	return fields
+}
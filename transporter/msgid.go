@@ -0,0 +1,46 @@
+package transporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// msgIDLength is the number of hex chars in MsgID
+const msgIDLength = 32
+
+// SetMsgID sets MsgID if it is empty.
+//
+// MsgID is built from team, channel, message ts and revision,
+// so the same message revision gets the same MsgID regardless of the way it was collected.
+// This allows skipping duplicates when the same history is exported multiple times.
+func (m *Message) SetMsgID() {
+	if m.MsgID != "" {
+		return
+	}
+	m.MsgID = NewMsgID(m)
+}
+
+// NewMsgID returns deterministic id of the message revision.
+//
+// Messages without Slack ts, for example replayed from dumps made before message_ts was added,
+// are identified by their time, thread and author.
+// Empty string is returned if the message has neither Slack ts nor time.
+func NewMsgID(m *Message) string {
+	ts := m.MessageTS
+	if ts == "" {
+		if m.TimeStamp == "" {
+			return ""
+		}
+		ts = m.TimeStamp + "/" + m.ThreadTimeStamp + "/" + m.UserID
+	}
+	if m.Type != "" && m.Type != "message" {
+		// channel events may share ts with messages
+		ts = m.Type + "/" + ts
+	}
+	hash := sha256.New()
+	for _, s := range []string{m.TeamID, m.ChannelID, ts, m.EditedTS} {
+		hash.Write([]byte(s))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:msgIDLength]
+}
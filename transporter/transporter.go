@@ -2,22 +2,59 @@ package transporter
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
+	"sync"
+	"time"
 )
 
 // Message represents data for storing in the logs
 type Message struct {
-	ThreadID              string `json:"thread_id"`
-	Type                  string `json:"type"`
-	User                  string `json:"user"`
-	Text                  string `json:"text"`
-	ThreadTimeStamp       string `json:"thread_ts"`
-	TimeStamp             string `json:"ts"`
-	ChannelID             string `json:"channel_id"`
-	ChannelName           string `json:"channel_name"`
+	ThreadID        string `json:"thread_id"`
+	Type            string `json:"type"`
+	SubType         string `json:"subtype"`
+	User            string `json:"user"`
+	Text            string `json:"text"`
+	ThreadTimeStamp string `json:"thread_ts"`
+	TimeStamp       string `json:"ts"`
+	// MessageTS is the original Slack message ts, which uniquely identifies the message in the channel
+	MessageTS string `json:"message_ts"`
+	// EditedTS is the ts of the last edit of the message. It is the message revision
+	EditedTS string `json:"edited_ts"`
+	// MsgID deterministically identifies the message revision, see SetMsgID
+	MsgID string `json:"msg_id"`
+	// Permalink is the link to the message in Slack
+	Permalink   string `json:"permalink"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// ConversationType is one of public_channel, private_channel, mpim or im
+	ConversationType      string `json:"conversation_type"`
+	TeamID                string `json:"team_id"`
+	TeamName              string `json:"team_name"`
 	UserID                string `json:"user_id"`
 	DisplayName           string `json:"display_name"`
 	DisplayNameNormalized string `json:"display_name_normalized"`
+	// UserTeam is the team of the author. IsExternal is set for authors from other organizations in Slack Connect channels
+	UserTeam   string `json:"user_team"`
+	IsExternal bool   `json:"is_external"`
+	// ParentUserID is the author of the thread root for thread replies
+	ParentUserID string `json:"parent_user_id"`
+	// ReplyCount is the number of replies in the thread for thread roots
+	ReplyCount int `json:"reply_count"`
+	// IsThreadRoot is false for thread replies
+	IsThreadRoot bool `json:"is_thread_root"`
+	// BotID and AppID are set for messages from bots, workflows and integrations
+	BotID string `json:"bot_id"`
+	AppID string `json:"app_id"`
+	IsBot bool   `json:"is_bot"`
+	// Inviter is the user who invited the member for member_joined_channel entries
+	Inviter string `json:"inviter"`
+}
+
+// Time returns the message time parsed from TimeStamp
+func (m *Message) Time() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, m.TimeStamp)
 }
 
 // Importer defines importer interface
@@ -26,6 +63,33 @@ type Importer interface {
 	Import(ctx context.Context, message Message) error
 }
 
+// DeliveryNotifier is implemented by importers, which may deliver messages after Import returns,
+// for example, importers which send messages in batches
+type DeliveryNotifier interface {
+	// OnDelivered registers f, which is called with messages after they are delivered
+	OnDelivered(f func(messages []Message))
+}
+
+// OnDelivered registers f for all the importers from i implementing DeliveryNotifier
+// including importers from MultiImporter.
+// It returns the number of such importers, so the caller can wait until the message is delivered by all of them.
+// Other importers deliver the message once their Import returns nil.
+func OnDelivered(i Importer, f func(messages []Message)) int {
+	switch t := i.(type) {
+	case MultiImporter:
+		n := 0
+		for _, child := range t {
+			n += OnDelivered(child, f)
+		}
+		return n
+	case DeliveryNotifier:
+		t.OnDelivered(f)
+		return 1
+	default:
+		return 0
+	}
+}
+
 // Exporter defines exporter interface
 // which should be implemented for each exporter
 type Exporter interface {
@@ -38,16 +102,118 @@ type Transport struct {
 	importer Importer
 }
 
-// Run starts export import process
+// Run starts export import process.
+// The exporter is notified about delivered messages if it implements DeliveryListener.
+// The importer is closed when the export is finished if it implements io.Closer.
+// The exporter is closed afterwards if it implements io.Closer, so it can persist messages delivered on importer close.
 func (p *Transport) Run(ctx context.Context) {
+	var tracker *deliveryTracker
+	if l, ok := p.exporter.(DeliveryListener); ok {
+		tracker = newDeliveryTracker(p.importer, l)
+	}
 	p.exporter.Export(ctx, func(m Message) {
+		m.SetMsgID()
+		if tracker != nil {
+			tracker.add(&m)
+		}
 		if err := p.importer.Import(ctx, m); err != nil {
 			log.Printf("error import message to the importer: %s", err)
+			if tracker != nil {
+				tracker.forget(&m)
+			}
+			return
+		}
+		if tracker != nil {
+			tracker.confirm(m.MsgID)
 		}
 	})
+	if c, ok := p.importer.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("error close importer: %s", err)
+		}
+	}
+	if c, ok := p.exporter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("error close exporter: %s", err)
+		}
+	}
 }
 
 func New(exporter Exporter, importer Importer) *Transport {
 	p := Transport{exporter: exporter, importer: importer}
 	return &p
 }
+
+// MultiExporter combines multiple exporters into a single one.
+// Messages from all the exporters are passed to the callback sequentially.
+type MultiExporter []Exporter
+
+// Export runs all the exporters concurrently and waits until all of them are finished
+func (me MultiExporter) Export(ctx context.Context, cb func(Message)) {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, e := range me {
+		wg.Add(1)
+		go func(e Exporter) {
+			defer wg.Done()
+			e.Export(ctx, func(m Message) {
+				mu.Lock()
+				cb(m)
+				mu.Unlock()
+			})
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Delivered notifies all the exporters implementing DeliveryListener about the delivered message
+func (me MultiExporter) Delivered(m Message) {
+	for _, e := range me {
+		if l, ok := e.(DeliveryListener); ok {
+			l.Delivered(m)
+		}
+	}
+}
+
+// Close closes all the exporters which implement io.Closer
+func (me MultiExporter) Close() error {
+	var errs []error
+	for _, e := range me {
+		if c, ok := e.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MultiImporter sends every message to all the importers
+type MultiImporter []Importer
+
+// Import sends message to all the importers.
+// It returns joined errors of all the failed importers.
+func (mi MultiImporter) Import(ctx context.Context, message Message) error {
+	var errs []error
+	for _, i := range mi {
+		if err := i.Import(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all the importers which implement io.Closer
+func (mi MultiImporter) Close() error {
+	var errs []error
+	for _, i := range mi {
+		if c, ok := i.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,7 +3,9 @@ package transporter
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Mock implementations of Importer and Exporter for testing purposes
@@ -60,3 +62,253 @@ func TestProcessorImportError(t *testing.T) {
 	ctx := context.Background()
 	processor.Run(ctx)
 }
+
+// listeningExporter records messages reported via DeliveryListener
+type listeningExporter struct {
+	mockExporter
+	delivered []string
+}
+
+func (le *listeningExporter) Delivered(m Message) {
+	le.delivered = append(le.delivered, m.Text)
+}
+
+// batchImporter sends messages via Batcher
+type batchImporter struct {
+	*Batcher
+}
+
+func (bi batchImporter) Import(ctx context.Context, m Message) error {
+	return bi.Add(ctx, m)
+}
+
+// Test for Transport notifying the exporter after all the importers deliver the message
+func TestProcessorDelivered(t *testing.T) {
+	var batchers []*Batcher
+	exp := &listeningExporter{}
+	exp.exportFunc = func(ctx context.Context, processMessage func(Message)) {
+		for _, ts := range []string{"1705399200.000100", "1705399260.000200", "1705399320.000300"} {
+			processMessage(Message{Type: "message", ChannelID: "C1", MessageTS: ts, Text: ts})
+		}
+		if len(exp.delivered) != 0 {
+			t.Errorf("unexpected delivered messages before batches are flushed: %q", exp.delivered)
+		}
+		_ = batchers[0].Flush(ctx)
+		if len(exp.delivered) != 0 {
+			t.Errorf("unexpected delivered messages before all the batches are flushed: %q", exp.delivered)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		batchers = append(batchers, NewBatcher(10, time.Hour, func(_ context.Context, _ []Message) error { return nil }))
+	}
+	rejecting := &mockImporter{
+		importFunc: func(_ context.Context, m Message) error {
+			if m.MessageTS == "1705399260.000200" {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	}
+	im := MultiImporter{batchImporter{batchers[0]}, batchImporter{batchers[1]}, rejecting}
+	New(exp, im).Run(context.Background())
+	// the rejected message isn't reported, while the rest are reported once the last batch is flushed on close
+	if strings.Join(exp.delivered, ",") != "1705399200.000100,1705399320.000300" {
+		t.Fatalf("unexpected delivered messages: %q", exp.delivered)
+	}
+}
+
+// Test for MultiExporter.Export method
+func TestMultiExporter(t *testing.T) {
+	newExporter := func(texts ...string) Exporter {
+		return &mockExporter{
+			exportFunc: func(ctx context.Context, processMessage func(Message)) {
+				for _, text := range texts {
+					processMessage(Message{Text: text})
+				}
+			},
+		}
+	}
+	me := MultiExporter{newExporter("a", "b"), newExporter("c")}
+	got := make(map[string]int)
+	me.Export(context.Background(), func(m Message) {
+		got[m.Text]++
+	})
+	if len(got) != 3 || got["a"] != 1 || got["b"] != 1 || got["c"] != 1 {
+		t.Fatalf("unexpected exported messages: %v", got)
+	}
+}
+
+// Test for Batcher flushing full batches and remaining messages on Close
+func TestBatcher(t *testing.T) {
+	var batches [][]Message
+	b := NewBatcher(2, time.Hour, func(_ context.Context, messages []Message) error {
+		batches = append(batches, messages)
+		return nil
+	})
+	for _, text := range []string{"a", "b", "c"} {
+		if err := b.Add(context.Background(), Message{Text: text}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("expecting a single full batch before Close; got %v", batches)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].Text != "c" {
+		t.Fatalf("unexpected batches after Close: %v", batches)
+	}
+}
+
+// Test for Batcher keeping messages of failed flushes
+func TestBatcherFlushError(t *testing.T) {
+	fail := true
+	var flushed []Message
+	b := NewBatcher(2, time.Hour, func(_ context.Context, messages []Message) error {
+		if fail {
+			return errors.New("destination is unavailable")
+		}
+		flushed = append(flushed, messages...)
+		return nil
+	})
+	for _, text := range []string{"a", "b", "c"} {
+		if err := b.Add(context.Background(), Message{Text: text}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := b.Flush(context.Background()); err == nil {
+		t.Fatalf("expecting flush error")
+	}
+
+	fail = false
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(flushed) != 3 || flushed[0].Text != "a" || flushed[2].Text != "c" {
+		t.Fatalf("unexpected flushed messages: %v", flushed)
+	}
+
+	// batches failed with permanent error are dropped
+	calls := 0
+	b = NewBatcher(10, time.Hour, func(_ context.Context, _ []Message) error {
+		calls++
+		return Permanent(errors.New("rejected"))
+	})
+	if err := b.Add(context.Background(), Message{Text: "a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := b.Flush(context.Background()); err == nil {
+		t.Fatalf("expecting flush error")
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 1 {
+		t.Fatalf("unexpected number of flushes; got %d; want 1", calls)
+	}
+}
+
+// Test for Batcher keeping only failed messages of partially failed flushes
+func TestBatcherPartialFlushError(t *testing.T) {
+	var flushed, delivered []string
+	partial := true
+	b := NewBatcher(10, time.Hour, func(_ context.Context, messages []Message) error {
+		for _, m := range messages {
+			flushed = append(flushed, m.Text)
+		}
+		if partial {
+			partial = false
+			return &PartialError{Failed: []int{1, 2}, Err: errors.New("partition is unavailable")}
+		}
+		return nil
+	})
+	b.OnDelivered(func(messages []Message) {
+		for _, m := range messages {
+			delivered = append(delivered, m.Text)
+		}
+	})
+	for _, text := range []string{"a", "b", "c"} {
+		if err := b.Add(context.Background(), Message{Text: text}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := b.Flush(context.Background()); err == nil {
+		t.Fatalf("expecting flush error")
+	}
+	if strings.Join(delivered, ",") != "a" {
+		t.Fatalf("unexpected delivered messages: %q", delivered)
+	}
+	if err := b.Add(context.Background(), Message{Text: "d"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// only the failed messages are sent again before the newer ones
+	if strings.Join(flushed, ",") != "a,b,c,b,c,d" || strings.Join(delivered, ",") != "a,b,c,d" {
+		t.Fatalf("unexpected flushed messages %q and delivered messages %q", flushed, delivered)
+	}
+}
+
+// Test for Message.Fields method
+func TestMessageFields(t *testing.T) {
+	m := Message{Text: "hello", ChannelID: "C1"}
+	fields := m.Fields()
+	if len(fields) != 2 || fields[0] != (Field{Name: "text", Value: "hello"}) || fields[1] != (Field{Name: "channel_id", Value: "C1"}) {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
+
+// Test for NewMsgID func
+func TestNewMsgID(t *testing.T) {
+	m := Message{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100", Text: "hello"}
+	id := NewMsgID(&m)
+	if len(id) != msgIDLength {
+		t.Fatalf("unexpected msg_id length; got %d; want %d", len(id), msgIDLength)
+	}
+
+	// the same message collected in a different way gets the same id
+	other := m
+	other.Text = "hello from backfill"
+	other.ThreadID = "thread"
+	if got := NewMsgID(&other); got != id {
+		t.Fatalf("unexpected msg_id; got %q; want %q", got, id)
+	}
+
+	// edits, channel events and other channels get different ids
+	for _, changed := range []Message{
+		{Type: "message", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100", EditedTS: "1705399300.000000"},
+		{Type: "channel_rename", TeamID: "T1", ChannelID: "C1", MessageTS: "1705399200.000100"},
+		{Type: "message", TeamID: "T1", ChannelID: "C2", MessageTS: "1705399200.000100"},
+		{Type: "message", TeamID: "T2", ChannelID: "C1", MessageTS: "1705399200.000100"},
+	} {
+		if got := NewMsgID(&changed); got == id {
+			t.Fatalf("expecting different msg_id for %+v", changed)
+		}
+	}
+
+	// legacy messages without message_ts are identified by their time, thread and author
+	legacy := []Message{
+		{TeamID: "T1", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:00Z", ThreadTimeStamp: "1705399200.000100", UserID: "U1"},
+		{TeamID: "T1", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:01Z", ThreadTimeStamp: "1705399200.000100", UserID: "U1"},
+		{TeamID: "T1", ChannelID: "C1", TimeStamp: "2024-01-16T10:00:00Z", ThreadTimeStamp: "1705399200.000100", UserID: "U2"},
+	}
+	seen := make(map[string]struct{})
+	for i := range legacy {
+		seen[NewMsgID(&legacy[i])] = struct{}{}
+	}
+	if len(seen) != len(legacy) {
+		t.Fatalf("expecting different msg_id for legacy messages; got %v", seen)
+	}
+	if got := NewMsgID(&Message{TeamID: "T1", ChannelID: "C1"}); got != "" {
+		t.Fatalf("expecting empty msg_id for message without ts; got %q", got)
+	}
+
+	// existing msg_id is preserved, e.g. for replayed messages
+	m.MsgID = "replayed"
+	m.SetMsgID()
+	if m.MsgID != "replayed" {
+		t.Fatalf("unexpected msg_id %q", m.MsgID)
+	}
+}
@@ -0,0 +1,263 @@
+package verify
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/slack"
+	"slack2logs/transporter"
+	"slack2logs/vmlogs"
+)
+
+const day = 24 * time.Hour
+
+var (
+	days = flag.Int("verify.days", 7, "The number of full days before the current UTC day to verify. "+
+		"Messages are counted per channel per day via conversations.history and compared with the number of messages stored in VictoriaLogs")
+	interval = flag.Duration("verify.interval", 0, "Interval for verifying messages stored in VictoriaLogs in the background. "+
+		"The background verification is disabled if zero. The cli verify command verifies messages once")
+	autoBackfill = flag.Bool("verify.autoBackfill", false, "Whether to backfill messages missing in VictoriaLogs for the days with mismatched counts")
+)
+
+var (
+	verifyRuns        = metrics.GetOrCreateCounter(`vm_slack2logs_verify_runs_total`)
+	verifySkippedDays = metrics.GetOrCreateCounter(`vm_slack2logs_verify_skipped_days_total`)
+	verifyErrors      = metrics.GetOrCreateCounter(`vm_slack2logs_errors_total{source="verify"}`)
+	backfilledCount   = metrics.GetOrCreateCounter(`vm_slack2logs_messages_received_total{source="verify"}`)
+	lastMismatches    atomic.Int64
+	_                 = metrics.GetOrCreateGauge(`vm_slack2logs_verify_mismatches`, func() float64 { return float64(lastMismatches.Load()) })
+)
+
+// source is a Slack workspace to verify messages from
+type source interface {
+	TeamID() string
+	Channels() []string
+	CountMessages(ctx context.Context, channelID string, start, end time.Time) (map[time.Time]int, error)
+	CollectMessages(ctx context.Context, channelID string, start, end time.Time, cb func(m transporter.Message)) error
+}
+
+// querier executes LogsQL queries
+type querier interface {
+	Query(ctx context.Context, query string, cb func(row map[string]string) error) error
+}
+
+// Mismatch represents a day with different number of messages in Slack and VictoriaLogs
+type Mismatch struct {
+	ChannelID string
+	Day       time.Time
+	Slack     int
+	Logs      int
+}
+
+// Verifier compares the number of messages in Slack and VictoriaLogs
+// and optionally backfills messages missing in VictoriaLogs.
+// See -verify.* flags.
+type Verifier struct {
+	sources      []source
+	logs         querier
+	days         int
+	interval     time.Duration
+	autoBackfill bool
+}
+
+// New returns Verifier for the given Slack clients
+func New(clients []*slack.Client) (*Verifier, error) {
+	logs, err := vmlogs.New()
+	if err != nil {
+		return nil, fmt.Errorf("error initialize VictoriaLogs client: %w", err)
+	}
+	if *days <= 0 {
+		return nil, fmt.Errorf("-verify.days must be positive; got %d", *days)
+	}
+	v := &Verifier{
+		logs:         logs,
+		days:         *days,
+		interval:     *interval,
+		autoBackfill: *autoBackfill,
+	}
+	for _, c := range clients {
+		v.sources = append(v.sources, c)
+	}
+	return v, nil
+}
+
+// Export runs verification once and logs mismatches.
+// It implements transporter.Exporter interface, so backfilled messages are sent to the outputs.
+func (v *Verifier) Export(ctx context.Context, cb func(m transporter.Message)) {
+	startTime := time.Now()
+	mismatches, err := v.Run(ctx, startTime, cb)
+	if err != nil {
+		log.Printf("error verify messages: %s", err)
+		verifyErrors.Inc()
+	}
+	lastMismatches.Store(int64(len(mismatches)))
+	log.Printf("verification finished in %s; found %d mismatched days", time.Since(startTime), len(mismatches))
+}
+
+// Job runs verification in the background every -verify.interval
+type Job struct {
+	v *Verifier
+}
+
+// NewJob returns background verification job for the given Slack clients.
+// It returns nil if -verify.interval isn't set.
+func NewJob(clients []*slack.Client) (*Job, error) {
+	if *interval <= 0 {
+		return nil, nil
+	}
+	v, err := New(clients)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{v: v}, nil
+}
+
+// Export runs verification every -verify.interval until ctx is done.
+// It implements transporter.Exporter interface, so backfilled messages are sent to the outputs.
+func (j *Job) Export(ctx context.Context, cb func(m transporter.Message)) {
+	ticker := time.NewTicker(j.v.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.v.Export(ctx, cb)
+		}
+	}
+}
+
+// Run compares the number of messages per channel per day for -verify.days before now.
+// If auto backfill is enabled, messages missing in VictoriaLogs are passed to cb.
+func (v *Verifier) Run(ctx context.Context, now time.Time, cb func(m transporter.Message)) ([]Mismatch, error) {
+	verifyRuns.Inc()
+	end := now.UTC().Truncate(day)
+	start := end.Add(-time.Duration(v.days) * day)
+	var mismatches []Mismatch
+	for _, src := range v.sources {
+		channels := src.Channels()
+		if len(channels) == 0 {
+			continue
+		}
+		teamID := src.TeamID()
+		logsCounts, err := v.countLogs(ctx, teamID, channels, start, end)
+		if err != nil {
+			return mismatches, err
+		}
+		legacyCounts, err := v.countLegacyLogs(ctx, channels, start, end)
+		if err != nil {
+			return mismatches, err
+		}
+		for _, channelID := range channels {
+			slackCounts, err := src.CountMessages(ctx, channelID, start, end)
+			if err != nil {
+				log.Printf("error count messages in channel %q: %s", channelID, err)
+				verifyErrors.Inc()
+				continue
+			}
+			for d := start; d.Before(end); d = d.Add(day) {
+				// such messages cannot be matched with Slack messages, so backfilling would duplicate them
+				if legacy := legacyCounts[channelID][d]; legacy > 0 {
+					log.Printf("skip verification of channel %q (team %s) for %s, since %d messages stored in VictoriaLogs have no message_ts",
+						channelID, teamID, d.Format(time.DateOnly), legacy)
+					verifySkippedDays.Inc()
+					continue
+				}
+				n, m := slackCounts[d], logsCounts[channelID][d]
+				if n == m {
+					continue
+				}
+				log.Printf("mismatch in channel %q (team %s) for %s: %d messages in Slack, %d messages in VictoriaLogs",
+					channelID, teamID, d.Format(time.DateOnly), n, m)
+				mismatches = append(mismatches, Mismatch{ChannelID: channelID, Day: d, Slack: n, Logs: m})
+				if !v.autoBackfill || n < m {
+					continue
+				}
+				backfilled, err := v.backfill(ctx, src, teamID, channelID, d, now, cb)
+				if err != nil {
+					log.Printf("error backfill channel %q for %s: %s", channelID, d.Format(time.DateOnly), err)
+					verifyErrors.Inc()
+					continue
+				}
+				log.Printf("backfilled %d messages in channel %q for %s", backfilled, channelID, d.Format(time.DateOnly))
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// countLogs returns the number of unique messages from the workspace teamID in VictoriaLogs per channel per day.
+// Only thread roots and standalone messages are counted in order to match counts obtained via conversations.history.
+// Unique message_ts values are counted, since edited messages may be stored multiple times.
+func (v *Verifier) countLogs(ctx context.Context, teamID string, channels []string, start, end time.Time) (map[string]map[time.Time]int, error) {
+	q := fmt.Sprintf(`_time:[%s, %s) team_id:=%s channel_id:in(%s) type:=message is_thread_root:=true | stats by (channel_id, _time:1d) count_uniq(message_ts) messages`,
+		start.Format(time.RFC3339), end.Format(time.RFC3339), teamID, strings.Join(channels, ","))
+	return v.queryDailyCounts(ctx, q)
+}
+
+// countLegacyLogs returns the number of messages without message_ts in VictoriaLogs per channel per day.
+// Such messages are stored by older versions, which didn't set message_ts, team_id and is_thread_root fields,
+// so they are counted for all the teams.
+func (v *Verifier) countLegacyLogs(ctx context.Context, channels []string, start, end time.Time) (map[string]map[time.Time]int, error) {
+	q := fmt.Sprintf(`_time:[%s, %s) channel_id:in(%s) type:=message message_ts:"" | stats by (channel_id, _time:1d) count() messages`,
+		start.Format(time.RFC3339), end.Format(time.RFC3339), strings.Join(channels, ","))
+	return v.queryDailyCounts(ctx, q)
+}
+
+// queryDailyCounts executes q returning messages per channel_id per day
+func (v *Verifier) queryDailyCounts(ctx context.Context, q string) (map[string]map[time.Time]int, error) {
+	counts := make(map[string]map[time.Time]int)
+	err := v.logs.Query(ctx, q, func(row map[string]string) error {
+		d, err := time.Parse(time.RFC3339, row["_time"])
+		if err != nil {
+			return fmt.Errorf("cannot parse _time in %v: %w", row, err)
+		}
+		n, err := strconv.Atoi(row["messages"])
+		if err != nil {
+			return fmt.Errorf("cannot parse messages in %v: %w", row, err)
+		}
+		channelID := row["channel_id"]
+		if counts[channelID] == nil {
+			counts[channelID] = make(map[time.Time]int)
+		}
+		counts[channelID][d.UTC()] += n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error count messages in VictoriaLogs: %w", err)
+	}
+	return counts, nil
+}
+
+// backfill passes messages posted in channelID on day d and replies to them to cb
+// unless they are already stored in VictoriaLogs
+func (v *Verifier) backfill(ctx context.Context, src source, teamID, channelID string, d, now time.Time, cb func(m transporter.Message)) (int, error) {
+	// replies may be posted on the next days
+	q := fmt.Sprintf(`_time:[%s, %s] team_id:=%s channel_id:=%s | uniq by (message_ts)`, d.Format(time.RFC3339), now.UTC().Format(time.RFC3339), teamID, channelID)
+	stored := make(map[string]struct{})
+	err := v.logs.Query(ctx, q, func(row map[string]string) error {
+		stored[row["message_ts"]] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error get stored messages from VictoriaLogs: %w", err)
+	}
+	n := 0
+	err = src.CollectMessages(ctx, channelID, d, d.Add(day), func(m transporter.Message) {
+		if _, ok := stored[m.MessageTS]; ok {
+			return
+		}
+		cb(m)
+		n++
+		backfilledCount.Inc()
+	})
+	return n, err
+}
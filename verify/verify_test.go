@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+type fakeSource struct {
+	counts   map[time.Time]int
+	messages []transporter.Message
+}
+
+func (fs *fakeSource) TeamID() string     { return "T1" }
+func (fs *fakeSource) Channels() []string { return []string{"C1"} }
+
+func (fs *fakeSource) CountMessages(_ context.Context, _ string, _, _ time.Time) (map[time.Time]int, error) {
+	return fs.counts, nil
+}
+
+func (fs *fakeSource) CollectMessages(_ context.Context, _ string, _, _ time.Time, cb func(m transporter.Message)) error {
+	for _, m := range fs.messages {
+		cb(m)
+	}
+	return nil
+}
+
+// fakeQuerier returns rows for the queries containing the given substrings
+type fakeQuerier map[string][]map[string]string
+
+func (fq fakeQuerier) Query(_ context.Context, query string, cb func(row map[string]string) error) error {
+	for substr, rows := range fq {
+		if !strings.Contains(query, substr) {
+			continue
+		}
+		for _, row := range rows {
+			if err := cb(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Test for Verifier.Run method
+func TestVerifierRun(t *testing.T) {
+	now := time.Date(2024, 1, 18, 10, 0, 0, 0, time.UTC)
+	day1 := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC)
+	src := &fakeSource{
+		counts: map[time.Time]int{day1: 3, day2: 3},
+		messages: []transporter.Message{
+			{ChannelID: "C1", MessageTS: "1705399200.000100", Text: "stored"},
+			{ChannelID: "C1", MessageTS: "1705485600.000100", Text: "missing"},
+			{ChannelID: "C1", MessageTS: "1705485700.000100", Text: "missing reply"},
+		},
+	}
+	logs := fakeQuerier{
+		"team_id:=T1 channel_id:in(C1) type:=message is_thread_root:=true | stats by (channel_id, _time:1d) count_uniq(message_ts)": {
+			{"channel_id": "C1", "_time": "2024-01-16T00:00:00Z", "messages": "2"},
+			{"channel_id": "C1", "_time": "2024-01-17T00:00:00Z", "messages": "1"},
+		},
+		// the message stored by older versions cannot be matched, so day1 is skipped
+		`message_ts:"" | stats by (channel_id, _time:1d) count()`: {
+			{"channel_id": "C1", "_time": "2024-01-16T00:00:00Z", "messages": "1"},
+		},
+		"team_id:=T1 channel_id:=C1 | uniq by (message_ts)": {
+			{"message_ts": "1705399200.000100"},
+		},
+	}
+	v := &Verifier{
+		sources:      []source{src},
+		logs:         logs,
+		days:         2,
+		autoBackfill: true,
+	}
+	var backfilled []string
+	mismatches, err := v.Run(context.Background(), now, func(m transporter.Message) {
+		backfilled = append(backfilled, m.Text)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := Mismatch{ChannelID: "C1", Day: day2, Slack: 3, Logs: 1}
+	if len(mismatches) != 1 || mismatches[0] != want {
+		t.Fatalf("unexpected mismatches; got %+v; want %+v", mismatches, want)
+	}
+	if len(backfilled) != 2 || backfilled[0] != "missing" || backfilled[1] != "missing reply" {
+		t.Fatalf("unexpected backfilled messages: %q", backfilled)
+	}
+
+	// mismatches are only reported if auto backfill is disabled
+	v.autoBackfill = false
+	backfilled = nil
+	if _, err := v.Run(context.Background(), now, func(m transporter.Message) {
+		backfilled = append(backfilled, m.Text)
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(backfilled) != 0 {
+		t.Fatalf("unexpected backfilled messages: %q", backfilled)
+	}
+}
@@ -0,0 +1,60 @@
+package vmlogs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const queryPath = "select/logsql/query"
+
+// maxQueryLineSize limits the size of a single line in the query response
+const maxQueryLineSize = 16 << 20
+
+// Query executes LogsQL query via /select/logsql/query and passes every returned row to cb.
+// See https://docs.victoriametrics.com/victorialogs/querying/#http-api
+func (c *Client) Query(ctx context.Context, query string, cb func(row map[string]string) error) error {
+	u := fmt.Sprintf("%s/%s", strings.TrimSuffix(*vmlogsAddr, "/"), queryPath)
+	body := url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error create query request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.authCfg != nil {
+		c.authCfg.SetHeaders(req, true)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unexpected error when performing query request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d for query %q: %s", resp.StatusCode, query, string(data))
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, maxQueryLineSize)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var row map[string]string
+		if err := json.Unmarshal(line, &row); err != nil {
+			return fmt.Errorf("cannot parse query response line %q: %w", line, err)
+		}
+		if err := cb(row); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error read query response: %w", err)
+	}
+	return nil
+}
@@ -27,9 +27,14 @@ var (
 	vmlogsPassword = flag.String("vmlogs.auth.password", "", "Password for VictoriaLogs HTTP server's Basic Auth.")
 )
 
+// StreamFields contains message fields, which are used as VictoriaLogs stream fields.
+// team_id separates streams of workspaces sharing Slack Connect channels.
+// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#stream-fields
+var StreamFields = []string{"channel_id", "channel_name", "team_id"}
+
 var (
 	defaultLogsFields = map[string][]string{
-		"_stream_fields": {"channel_id", "channel_name"},
+		"_stream_fields": StreamFields,
 		"_msg_field":     {"text"},
 		"_time_field":    {"ts"},
 	}
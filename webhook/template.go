@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const defaultTemplate = "{{ json . }}"
+
+// payloadTemplate renders request payload for messages
+type payloadTemplate struct {
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	// json returns JSON representation of v
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+	// quote returns s as JSON string, so it can be embedded into JSON payload
+	"quote": func(s string) (string, error) {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"truncate": truncate,
+}
+
+// loadPayloadTemplate returns template defined inline or in the file
+func loadPayloadTemplate(inline, path string) (*payloadTemplate, error) {
+	if inline != "" && path != "" {
+		return nil, fmt.Errorf("-webhook.template and -webhook.templateFile cannot be set simultaneously")
+	}
+	s := inline
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read -webhook.templateFile=%q: %w", path, err)
+		}
+		s = string(data)
+	}
+	if s == "" {
+		s = defaultTemplate
+	}
+	return parsePayloadTemplate(s)
+}
+
+func parsePayloadTemplate(s string) (*payloadTemplate, error) {
+	tmpl, err := template.New("payload").Option("missingkey=error").Funcs(templateFuncs).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse webhook template: %w", err)
+	}
+	return &payloadTemplate{tmpl: tmpl}, nil
+}
+
+// execute renders payload for data, which is
+// either a single message or a list of messages
+func (pt *payloadTemplate) execute(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pt.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("cannot execute webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// truncate returns the first n runes of s
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"slack2logs/flagutil"
+	"slack2logs/transporter"
+)
+
+const (
+	modeSingle = "single"
+	modeBatch  = "batch"
+
+	// TimestampHeader contains unix timestamp of the signed request
+	TimestampHeader = "X-Slack2logs-Timestamp"
+	// SignatureHeader contains HMAC-SHA256 signature of the request
+	SignatureHeader = "X-Slack2logs-Signature"
+)
+
+var (
+	webhookURLs     = flagutil.NewArrayString("webhook.url", "URLs to POST messages to if -output contains webhook. Every URL receives every payload")
+	webhookMode     = flag.String("webhook.mode", modeSingle, "Webhook mode. Supported values: single - every message is sent in a separate request, batch - messages are sent in batches")
+	webhookTemplate = flag.String("webhook.template", "", "Go text/template for the request payload. The template is executed for a message in single mode and for a list of messages in batch mode. "+
+		"Messages are sent as JSON if empty. See https://pkg.go.dev/text/template")
+	webhookTemplateFile  = flag.String("webhook.templateFile", "", "Path to the file with Go text/template for the request payload. See -webhook.template")
+	webhookContentType   = flag.String("webhook.contentType", "application/json", "Content-Type header for webhook requests")
+	webhookHeaders       = flagutil.NewArrayString("webhook.headers", "Optional HTTP headers to send with every webhook request in the form 'Name: value'")
+	webhookSigningSecret = flag.String("webhook.signingSecret", "", "Optional secret for signing webhook requests with HMAC-SHA256. "+
+		"The signature of '<timestamp>.<body>' is sent in "+SignatureHeader+" header as sha256=<hex>, the timestamp is sent in "+TimestampHeader+" header")
+	webhookBatchSize     = flag.Int("webhook.batchSize", 100, "The maximum number of messages in a single webhook request in batch mode")
+	webhookFlushInterval = flag.Duration("webhook.flushInterval", 5*time.Second, "The maximum interval between webhook requests in batch mode if there are pending messages")
+	webhookMaxRetries    = flag.Int("webhook.maxRetries", 3, "The maximum number of retries for webhook requests failed with network errors, 429 or 5xx status codes")
+	webhookRetryInterval = flag.Duration("webhook.retryInterval", time.Second, "Interval between retries of failed webhook requests")
+)
+
+var (
+	messagesDeliveryCount = metrics.GetOrCreateCounter(`vm_slack2logs_messages_delivery_total{destination="webhook"}`)
+	handleMessageErrors   = metrics.GetOrCreateCounter(`vm_slack2logs_delivery_errors_total{destination="webhook"}`)
+)
+
+// Client is an HTTP client for sending messages
+// to an arbitrary URL with templated payloads
+type Client struct {
+	httpClient    *http.Client
+	url           string
+	payload       *payloadTemplate
+	contentType   string
+	headers       http.Header
+	signingSecret []byte
+	maxRetries    int
+	retryInterval time.Duration
+	// batcher is nil in single mode
+	batcher *transporter.Batcher
+	// onDelivered contains funcs registered via OnDelivered in single mode
+	onDelivered []func(messages []transporter.Message)
+}
+
+// New returns importer configured via -webhook.* flags.
+//
+// Every URL from -webhook.url gets its own Client with its own batch and retries,
+// so URLs, which accepted messages, don't receive them again when other URLs fail.
+// transporter.MultiImporter is returned for multiple URLs.
+func New() (transporter.Importer, error) {
+	if len(*webhookURLs) == 0 {
+		return nil, fmt.Errorf("-webhook.url cannot be empty")
+	}
+	payload, err := loadPayloadTemplate(*webhookTemplate, *webhookTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(http.Header)
+	for _, h := range *webhookHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("incorrect -webhook.headers=%q; want 'Name: value'", h)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if *webhookMode != modeSingle && *webhookMode != modeBatch {
+		return nil, fmt.Errorf("unsupported -webhook.mode=%q; supported values: %s, %s", *webhookMode, modeSingle, modeBatch)
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{},
+		Timeout:   30 * time.Second,
+	}
+	var clients transporter.MultiImporter
+	for _, u := range *webhookURLs {
+		c := &Client{
+			httpClient:    httpClient,
+			url:           u,
+			payload:       payload,
+			contentType:   *webhookContentType,
+			headers:       headers,
+			signingSecret: []byte(*webhookSigningSecret),
+			maxRetries:    *webhookMaxRetries,
+			retryInterval: *webhookRetryInterval,
+		}
+		if *webhookMode == modeBatch {
+			c.batcher = transporter.NewBatcher(*webhookBatchSize, *webhookFlushInterval, c.sendBatch)
+		}
+		clients = append(clients, c)
+	}
+	if len(clients) == 1 {
+		return clients[0], nil
+	}
+	return clients, nil
+}
+
+// Import sends message to the webhook URL in single mode
+// or adds it to the batch in batch mode
+func (c *Client) Import(ctx context.Context, message transporter.Message) error {
+	if c.batcher != nil {
+		return c.batcher.Add(ctx, message)
+	}
+	messagesDeliveryCount.Inc()
+	body, err := c.payload.execute(message)
+	if err != nil {
+		handleMessageErrors.Inc()
+		return err
+	}
+	if err := c.send(ctx, body); err != nil {
+		handleMessageErrors.Inc()
+		return err
+	}
+	for _, f := range c.onDelivered {
+		f([]transporter.Message{message})
+	}
+	return nil
+}
+
+// OnDelivered registers f, which is called with messages after they are sent.
+// It implements transporter.DeliveryNotifier.
+// It must be called before sending messages.
+func (c *Client) OnDelivered(f func(messages []transporter.Message)) {
+	if c.batcher != nil {
+		c.batcher.OnDelivered(f)
+		return
+	}
+	c.onDelivered = append(c.onDelivered, f)
+}
+
+// Close sends pending messages in batch mode
+func (c *Client) Close() error {
+	if c.batcher == nil {
+		return nil
+	}
+	return c.batcher.Close()
+}
+
+func (c *Client) sendBatch(ctx context.Context, messages []transporter.Message) error {
+	messagesDeliveryCount.Add(len(messages))
+	body, err := c.payload.execute(messages)
+	if err != nil {
+		handleMessageErrors.Add(len(messages))
+		return transporter.Permanent(err)
+	}
+	if err := c.send(ctx, body); err != nil {
+		handleMessageErrors.Add(len(messages))
+		return err
+	}
+	return nil
+}
+
+// send sends body to the webhook URL.
+// It returns transporter.PermanentError if the URL rejected the request.
+func (c *Client) send(ctx context.Context, body []byte) error {
+	retryable, err := c.sendWithRetries(ctx, c.url, body)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("cannot send webhook to %q: %w", c.url, err)
+	if !retryable {
+		return transporter.Permanent(err)
+	}
+	return err
+}
+
+// sendWithRetries sends body to u according to -webhook.maxRetries.
+// It returns whether the request may be retried later in case of error.
+func (c *Client) sendWithRetries(ctx context.Context, u string, body []byte) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		retryable, err := c.post(ctx, u, body)
+		if err == nil {
+			return false, nil
+		}
+		if ctx.Err() != nil {
+			// the request is interrupted, so it may be sent later
+			return true, err
+		}
+		if !retryable || attempt >= c.maxRetries {
+			return retryable, err
+		}
+		log.Printf("webhook request to %q failed: %s; retrying in %s", u, err, c.retryInterval)
+		t := time.NewTimer(c.retryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return true, errors.Join(err, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// post performs a single request.
+// It returns whether the request may be retried in case of error.
+func (c *Client) post(ctx context.Context, u string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error create webhook request: %w", err)
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", c.contentType)
+	if len(c.signingSecret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, Sign(c.signingSecret, ts, body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("unexpected error when performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, fmt.Errorf("failed to read response body for status code %d: %s", resp.StatusCode, err)
+		}
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retryable, fmt.Errorf("unexpected response code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return false, nil
+}
+
+// Sign returns signature of the request body with the given timestamp
+// in the form sha256=<hex>, which is sent in SignatureHeader
+func Sign(secret []byte, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"slack2logs/transporter"
+)
+
+// webhookServer records received payloads.
+// It responds with 503 to the first failFirst requests.
+type webhookServer struct {
+	t         *testing.T
+	secret    []byte
+	failFirst int
+
+	mu       sync.Mutex
+	requests int
+	payloads []string
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("cannot read request body: %s", err)
+	}
+	if len(s.secret) > 0 {
+		want := Sign(s.secret, r.Header.Get(TimestampHeader), body)
+		if got := r.Header.Get(SignatureHeader); got != want {
+			s.t.Errorf("unexpected signature; got %q; want %q", got, want)
+		}
+	}
+	if s.requests <= s.failFirst {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.payloads = append(s.payloads, string(body))
+}
+
+func newTestClient(t *testing.T, tmpl string, ws *webhookServer) *Client {
+	t.Helper()
+	srv := httptest.NewServer(ws)
+	t.Cleanup(srv.Close)
+	pt, err := parsePayloadTemplate(tmpl)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return &Client{
+		httpClient:    srv.Client(),
+		url:           srv.URL,
+		payload:       pt,
+		contentType:   "application/json",
+		signingSecret: ws.secret,
+		maxRetries:    2,
+		retryInterval: time.Millisecond,
+	}
+}
+
+// Test for Client in single mode with signed requests and retries
+func TestClientSingle(t *testing.T) {
+	ws := &webhookServer{t: t, secret: []byte("secret"), failFirst: 1}
+	c := newTestClient(t, `{"summary":{{ quote (truncate 5 .Text) }},"channel":"{{ .ChannelName }}"}`, ws)
+	m := transporter.Message{Text: "customer cannot login", ChannelName: "support"}
+	if err := c.Import(context.Background(), m); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `{"summary":"custo","channel":"support"}`
+	if ws.requests != 2 || len(ws.payloads) != 1 || ws.payloads[0] != want {
+		t.Fatalf("unexpected payloads after %d requests; got %q; want %q", ws.requests, ws.payloads, want)
+	}
+
+	ws.failFirst = 10
+	if err := c.Import(context.Background(), m); err == nil {
+		t.Fatalf("expecting non-nil error after retries")
+	}
+	if ws.requests != 5 {
+		t.Fatalf("unexpected number of requests; got %d; want 5", ws.requests)
+	}
+}
+
+// Test for Client in batch mode
+func TestClientBatch(t *testing.T) {
+	ws := &webhookServer{t: t}
+	c := newTestClient(t, `{{ range $i, $m := . }}{{ if $i }},{{ end }}{{ $m.Text }}{{ end }}`, ws)
+	c.batcher = transporter.NewBatcher(2, time.Hour, c.sendBatch)
+	for _, text := range []string{"a", "b", "c"} {
+		if err := c.Import(context.Background(), transporter.Message{Text: text}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+	if len(ws.payloads) != 2 || ws.payloads[0] != "a,b" || ws.payloads[1] != "c" {
+		t.Fatalf("unexpected payloads: %q", ws.payloads)
+	}
+}
+
+// Test for sending batches to multiple URLs independently
+func TestNewMultipleURLs(t *testing.T) {
+	failing := &webhookServer{t: t, failFirst: 2}
+	ok := &webhookServer{t: t}
+	failingSrv := httptest.NewServer(failing)
+	defer failingSrv.Close()
+	okSrv := httptest.NewServer(ok)
+	defer okSrv.Close()
+
+	origURLs, origMode, origRetries, origInterval := *webhookURLs, *webhookMode, *webhookMaxRetries, *webhookRetryInterval
+	defer func() {
+		*webhookURLs, *webhookMode, *webhookMaxRetries, *webhookRetryInterval = origURLs, origMode, origRetries, origInterval
+	}()
+	*webhookURLs = []string{failingSrv.URL, okSrv.URL}
+	*webhookMode = modeBatch
+	*webhookMaxRetries = 0
+	*webhookRetryInterval = time.Millisecond
+
+	im, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	clients, isMulti := im.(transporter.MultiImporter)
+	if !isMulti || len(clients) != 2 {
+		t.Fatalf("expecting MultiImporter with 2 clients; got %T", im)
+	}
+	if err := im.Import(context.Background(), transporter.Message{Text: "a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the first URL fails twice, so only it gets the batch again
+	for i := 0; i < 2; i++ {
+		for _, c := range clients {
+			_ = c.(*Client).batcher.Flush(context.Background())
+		}
+	}
+	if err := clients.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+	if ok.requests != 1 || len(ok.payloads) != 1 {
+		t.Fatalf("unexpected requests to the available URL: %d", ok.requests)
+	}
+	if failing.requests != 3 || len(failing.payloads) != 1 {
+		t.Fatalf("unexpected requests to the failing URL: %d", failing.requests)
+	}
+}